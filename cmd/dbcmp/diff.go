@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func diffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff",
+		Short: "Reports the primary keys of the rows that differ",
+		Long:  "diff drills down into the mismatching pages and reports which primary keys are missing in the target, extra in the target or changed.",
+		RunE:  runDiffCmdFn,
+	}
+}
+
+func runDiffCmdFn(cmd *cobra.Command, args []string) error {
+	source, target, err := dsnFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := compareOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	diffs, warnings, err := store.Diff(cmd.Context(), source, target, opts)
+	printWarnings(warnings)
+	if err != nil {
+		return fmt.Errorf("error during comparison: %w", err)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("Database values are same.")
+		return nil
+	}
+
+	for _, d := range diffs {
+		fmt.Printf("%s (%d missing, %d extra, %d changed)\n", d.TableName, len(d.Missing), len(d.Extra), len(d.Changed))
+		printKeys("missing in target", d.Missing)
+		printKeys("extra in target", d.Extra)
+		printKeys("changed", d.Changed)
+	}
+	os.Exit(1)
+
+	return nil
+}
+
+// printWarnings writes the warnings to stderr, the results stay intact on
+// stdout.
+func printWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
+func printKeys(title string, keys [][]any) {
+	for _, k := range keys {
+		fmt.Printf("  %s: %v\n", title, k)
+	}
+}
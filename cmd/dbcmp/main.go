@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime/debug"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mattermost/dbcmp/internal/store"
 	"github.com/spf13/cobra"
@@ -13,6 +17,21 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// the exit status of a comparison is a bitmask of its outcomes, so that the
+// differences and the failed tables are reflected at the same time.
+const (
+	// exitMismatch means the databases differ.
+	exitMismatch = 1
+	// exitError means some of the tables could not be compared.
+	exitError = 2
+	// exitIncomplete means the comparison was interrupted.
+	exitIncomplete = 4
+)
+
+// exitFailure is the exit status of a command failing as a whole, it's kept
+// apart from the bitmask for the scripts relying on it.
+const exitFailure = 1
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:     "dbcmp",
@@ -24,57 +43,293 @@ func main() {
 
 	rootCmd.PersistentFlags().String("source", "", "source database dsn")
 	rootCmd.PersistentFlags().String("target", "", "target database dsn")
-	rootCmd.Flags().StringSlice("exclude", []string{}, "exclude tables from comparison, takes comma-separated values.")
-	rootCmd.Flags().Int("page-size", 1000, "page size for each checksum comparison.")
+	rootCmd.PersistentFlags().StringSlice("exclude", []string{}, "exclude tables from comparison, takes comma-separated values.")
+	rootCmd.PersistentFlags().Int("page-size", 1000, "page size for each checksum comparison.")
+	rootCmd.PersistentFlags().Bool("binary-key-order", false, "compare the string keys byte-wise instead of in the order of the key collations, for the databases of the same dialect with different collations. It's always on for the databases of different dialects.")
+	rootCmd.PersistentFlags().StringArray("order-key", []string{}, "page the table by the given columns containing a unique index instead of its primary key, e.g. Posts=CreateAt,Id. It can be repeated.")
+	rootCmd.PersistentFlags().Duration("statement-timeout", 0, "abort the queries running longer than the given duration, e.g. 5m, 0 disables it.")
+	rootCmd.PersistentFlags().Int("retries", 3, "number of times a query failing with a transient error, such as a deadlock or a dropped connection, is retried.")
+	rootCmd.PersistentFlags().Duration("retry-backoff", 500*time.Millisecond, "delay before the first retry of a query, it doubles after each retry.")
+	rootCmd.Flags().Int("min-range-size", 0, "split the mismatching pages until the differing key ranges have at most this many rows, 0 disables it.")
+	rootCmd.Flags().String("partitioning", string(store.PartitioningPages), "the way the tables are split up, one of: pages, buckets.")
+	rootCmd.Flags().Int("buckets", 64, "number of buckets the rows are grouped into by the hash of their primary keys.")
+	rootCmd.Flags().Int("parallel", 1, "number of tables compared concurrently, it's also the maximum number of connections to each database.")
+	rootCmd.Flags().Int("splits", 1, "number of key ranges the large tables are split into to compare them concurrently.")
+	rootCmd.Flags().String("shard", "", "compare the i-th of n deterministic subsets of the tables, e.g. 2/4, and write a partial JSON report, requires --output=json or --report-file.")
+	rootCmd.Flags().Bool("shard-key-ranges", false, "shard the splits of the tables instead of the tables, requires --shard.")
+	rootCmd.Flags().String("state-file", "", "write the progress of the comparison into the given file, it's removed once the comparison completes.")
+	rootCmd.Flags().String("snapshot", "", "read the tables from consistent snapshots, one per table or for the whole run, one of: table, run.")
+	rootCmd.Flags().Int("reverify", 0, "check a mismatching page or row count again up to this many times before reporting it as different, 0 disables it.")
+	rootCmd.Flags().Duration("reverify-delay", 5*time.Second, "delay before each re-check of a mismatch.")
+	rootCmd.Flags().Bool("keep-going", false, "compare the remaining tables after a table fails, the failed tables are reported with their errors.")
+	rootCmd.Flags().Bool("resume", false, "continue an interrupted comparison from the state file, the databases and the options must be the same.")
+	rootCmd.Flags().Bool("common-columns", false, "compare only the columns that exist on both sides instead of reporting a schema mismatch.")
+	rootCmd.Flags().Bool("fail-on-missing", true, "fail the comparison if a source table is missing in the target.")
+	rootCmd.Flags().Bool("fail-on-extra", false, "fail the comparison if a target table is missing in the source.")
+	rootCmd.Flags().String("output", outputText, "output format, one of: text, json, ndjson, html.")
+	rootCmd.Flags().String("report-file", "", "write the report into the given file and print the summary to stdout.")
+
+	rootCmd.AddCommand(diffCmd())
+	rootCmd.AddCommand(repairCmd())
+	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(schemaCmd())
+	rootCmd.AddCommand(mergeReportsCmd())
+
+	// the first signal cancels the running queries so that the partial
+	// report can be written, the second one terminates the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 }
 
 func runRootCmdFn(cmd *cobra.Command, args []string) error {
-	source, err := cmd.Flags().GetString("source")
+	source, target, err := dsnFlags(cmd)
 	if err != nil {
 		return err
 	}
 
-	target, err := cmd.Flags().GetString("target")
+	opts, err := compareOptionsFromFlags(cmd)
 	if err != nil {
 		return err
 	}
 
-	excl, err := cmd.Flags().GetStringSlice("exclude")
+	minRangeSize, err := cmd.Flags().GetInt("min-range-size")
 	if err != nil {
 		return err
 	}
 
-	pageSize, err := cmd.Flags().GetInt("page-size")
+	if minRangeSize < 0 {
+		return fmt.Errorf("min range size could not be negative, current value is: %d", minRangeSize)
+	}
+	opts.MinRangeSize = minRangeSize
+
+	partitioning, err := cmd.Flags().GetString("partitioning")
 	if err != nil {
 		return err
 	}
+	opts.Partitioning = store.Partitioning(partitioning)
 
-	if pageSize < 2 {
-		return fmt.Errorf("page size could not be less than 2 (two), current value is: %d", pageSize)
+	opts.Buckets, err = cmd.Flags().GetInt("buckets")
+	if err != nil {
+		return err
+	}
+
+	parallelism, err := cmd.Flags().GetInt("parallel")
+	if err != nil {
+		return err
+	}
+
+	if parallelism < 1 {
+		return fmt.Errorf("parallelism could not be less than 1 (one), current value is: %d", parallelism)
+	}
+	opts.Parallelism = parallelism
+
+	splits, err := cmd.Flags().GetInt("splits")
+	if err != nil {
+		return err
+	}
+
+	if splits < 1 {
+		return fmt.Errorf("splits could not be less than 1 (one), current value is: %d", splits)
+	}
+	opts.Splits = splits
+
+	shard, err := cmd.Flags().GetString("shard")
+	if err != nil {
+		return err
+	}
+
+	if shard != "" {
+		opts.Shard, err = store.ParseShard(shard)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.ShardKeyRanges, err = cmd.Flags().GetBool("shard-key-ranges")
+	if err != nil {
+		return err
+	}
+
+	opts.StateFile, err = cmd.Flags().GetString("state-file")
+	if err != nil {
+		return err
+	}
+
+	opts.Resume, err = cmd.Flags().GetBool("resume")
+	if err != nil {
+		return err
+	}
+
+	opts.KeepGoing, err = cmd.Flags().GetBool("keep-going")
+	if err != nil {
+		return err
+	}
+
+	opts.Reverify, err = cmd.Flags().GetInt("reverify")
+	if err != nil {
+		return err
+	}
+
+	opts.ReverifyDelay, err = cmd.Flags().GetDuration("reverify-delay")
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := cmd.Flags().GetString("snapshot")
+	if err != nil {
+		return err
+	}
+	opts.Snapshot = store.SnapshotScope(snapshot)
+
+	opts.CommonColumns, err = cmd.Flags().GetBool("common-columns")
+	if err != nil {
+		return err
 	}
 
-	diffs, err := store.Compare(source, target, store.CompareOptions{
-		ExcludePatterns: excl,
-		PageSize:        pageSize,
-	})
+	failOnMissing, err := cmd.Flags().GetBool("fail-on-missing")
 	if err != nil {
+		return err
+	}
+	opts.AllowMissingTables = !failOnMissing
+
+	opts.FailOnExtraTables, err = cmd.Flags().GetBool("fail-on-extra")
+	if err != nil {
+		return err
+	}
+
+	rep, err := newReporter(cmd, opts.Shard != nil)
+	if err != nil {
+		return err
+	}
+	rep.attach(&opts)
+
+	result, err := store.Compare(cmd.Context(), source, target, opts)
+	if result != nil {
+		if rerr := rep.finish(result, opts); rerr != nil {
+			return rerr
+		}
+	}
+	if err != nil && (result == nil || !result.Incomplete) {
 		return fmt.Errorf("error during comparison: %w", err)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	if rep.human {
+		printSummary(result)
 	}
 
-	if len(diffs) > 0 {
-		fmt.Printf("Database values differ. Tables: %s\n", strings.Join(diffs, ", "))
-		os.Exit(1)
+	errs := len(result.Errors())
+	if code := exitCode(len(result.Mismatches())-errs, errs, result.Incomplete); code != 0 {
+		os.Exit(code)
 	}
 
-	fmt.Println("Database values are same.")
 	return nil
 }
 
+// exitCode returns the exit status of a comparison from the number of the
+// differing and the failed tables.
+func exitCode(mismatches, errs int, incomplete bool) int {
+	code := 0
+	if mismatches > 0 {
+		code |= exitMismatch
+	}
+	if errs > 0 {
+		code |= exitError
+	}
+	if incomplete {
+		code |= exitIncomplete
+	}
+
+	return code
+}
+
+func dsnFlags(cmd *cobra.Command) (string, string, error) {
+	source, err := cmd.Flags().GetString("source")
+	if err != nil {
+		return "", "", err
+	}
+
+	target, err := cmd.Flags().GetString("target")
+	if err != nil {
+		return "", "", err
+	}
+
+	return source, target, nil
+}
+
+func compareOptionsFromFlags(cmd *cobra.Command) (store.CompareOptions, error) {
+	excl, err := cmd.Flags().GetStringSlice("exclude")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	pageSize, err := cmd.Flags().GetInt("page-size")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	if pageSize < 2 {
+		return store.CompareOptions{}, fmt.Errorf("page size could not be less than 2 (two), current value is: %d", pageSize)
+	}
+
+	binaryKeyOrder, err := cmd.Flags().GetBool("binary-key-order")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	orderKeys, err := cmd.Flags().GetStringArray("order-key")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	orderingKeys := make(map[string][]string, len(orderKeys))
+	for _, k := range orderKeys {
+		table, columns, ok := strings.Cut(k, "=")
+		if !ok || table == "" || columns == "" {
+			return store.CompareOptions{}, fmt.Errorf("invalid order key %q, it should be in the form of Table=Column1,Column2", k)
+		}
+		orderingKeys[table] = strings.Split(columns, ",")
+	}
+
+	statementTimeout, err := cmd.Flags().GetDuration("statement-timeout")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	retries, err := cmd.Flags().GetInt("retries")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	if retries < 0 {
+		return store.CompareOptions{}, fmt.Errorf("retries could not be less than 0 (zero), current value is: %d", retries)
+	}
+
+	retryBackoff, err := cmd.Flags().GetDuration("retry-backoff")
+	if err != nil {
+		return store.CompareOptions{}, err
+	}
+
+	return store.CompareOptions{
+		ExcludePatterns:  excl,
+		PageSize:         pageSize,
+		BinaryKeyOrder:   binaryKeyOrder,
+		OrderingKeys:     orderingKeys,
+		StatementTimeout: statementTimeout,
+		Retries:          retries,
+		RetryBackoff:     retryBackoff,
+	}, nil
+}
+
 func versionCmdFn() string {
 	version := "unknown"
 	buildDate := "unkonwn"
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattermost/dbcmp/internal/report"
+	"github.com/spf13/cobra"
+)
+
+func mergeReportsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge-reports report.json...",
+		Short: "Merges the partial reports of the shards",
+		Long:  "merge-reports combines the partial JSON reports written by the shards of a comparison into a single report. The reports of all shards are required.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runMergeReportsCmdFn,
+	}
+
+	cmd.Flags().String("output", outputText, "output format, one of: text, json, html.")
+	cmd.Flags().String("report-file", "", "write the merged report into the given file and print the summary to stdout.")
+
+	return cmd
+}
+
+func runMergeReportsCmdFn(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	reportFile, err := cmd.Flags().GetString("report-file")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case outputText, outputJSON, outputHTML:
+	default:
+		return fmt.Errorf("unknown output format %q, valid values are: %s", format, strings.Join([]string{outputText, outputJSON, outputHTML}, ", "))
+	}
+
+	reports := make([]*report.Report, 0, len(args))
+	for _, name := range args {
+		r, err := readReport(name)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, r)
+	}
+
+	merged, err := report.Merge(reports)
+	if err != nil {
+		return fmt.Errorf("could not merge reports: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	human := format == outputText
+	if reportFile != "" {
+		f, err := os.Create(reportFile)
+		if err != nil {
+			return fmt.Errorf("could not create report file: %w", err)
+		}
+		defer f.Close()
+
+		w = f
+		human = true
+		// a report file is always machine readable
+		if format == outputText {
+			format = outputJSON
+		}
+	}
+
+	switch format {
+	case outputJSON:
+		err = report.WriteJSON(w, merged)
+	case outputHTML:
+		err = report.WriteHTML(w, merged)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+
+	if human {
+		printReportSummary(merged)
+	}
+
+	errs := len(merged.Errors())
+	if code := exitCode(len(merged.Mismatches())-errs, errs, merged.Incomplete); code != 0 {
+		os.Exit(code)
+	}
+
+	return nil
+}
+
+func readReport(name string) (*report.Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open report: %w", err)
+	}
+	defer f.Close()
+
+	r, err := report.ReadJSON(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read report %q: %w", name, err)
+	}
+
+	return r, nil
+}
+
+func printReportSummary(r *report.Report) {
+	if r.Incomplete {
+		fmt.Println("At least one of the shards was interrupted, the report is incomplete.")
+	}
+
+	mismatches := r.Mismatches()
+	if len(mismatches) == 0 {
+		if !r.Incomplete {
+			fmt.Println("Database values are same.")
+		}
+		return
+	}
+
+	tables := make([]string, len(mismatches))
+	for i := range mismatches {
+		tables[i] = mismatches[i].Name
+	}
+	fmt.Printf("Database values differ. Tables: %s\n", strings.Join(tables, ", "))
+
+	for _, t := range mismatches {
+		fmt.Printf("  %s: %s (source rows: %d, target rows: %d)\n", t.Name, t.Status, t.SourceRows, t.TargetRows)
+		if t.Error != "" {
+			fmt.Printf("    error: %s\n", t.Error)
+		}
+		for _, r := range t.MismatchedSplits {
+			fmt.Printf("    split: %s\n", r)
+		}
+		for _, r := range t.MismatchedRanges {
+			fmt.Printf("    range: %s\n", r)
+		}
+		if len(t.MismatchedBuckets) > 0 {
+			fmt.Printf("    mismatched buckets: %v\n", t.MismatchedBuckets)
+		}
+	}
+}
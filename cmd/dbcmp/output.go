@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattermost/dbcmp/internal/report"
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputHTML   = "html"
+)
+
+// reporter writes the report of a comparison in the requested format. The
+// report goes to the stdout unless a report file is given, in which case the
+// human readable summary is printed to the stdout as well.
+type reporter struct {
+	format    string
+	w         io.Writer
+	file      *os.File
+	ndjson    *report.NDJSONWriter
+	human     bool
+	startedAt time.Time
+	err       error
+}
+
+func newReporter(cmd *cobra.Command, partial bool) (*reporter, error) {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+
+	reportFile, err := cmd.Flags().GetString("report-file")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case outputText, outputJSON, outputNDJSON, outputHTML:
+	default:
+		return nil, fmt.Errorf("unknown output format %q, valid values are: %s", format, strings.Join([]string{outputText, outputJSON, outputNDJSON, outputHTML}, ", "))
+	}
+
+	// the partial reports of the shards are combined by merge-reports, it
+	// reads the JSON reports only.
+	if partial && format != outputJSON && (format != outputText || reportFile == "") {
+		return nil, errors.New("a shard writes a partial JSON report, it requires --output=json or --report-file")
+	}
+
+	r := &reporter{
+		format:    format,
+		w:         os.Stdout,
+		human:     format == outputText,
+		startedAt: time.Now(),
+	}
+
+	if reportFile != "" {
+		f, err := os.Create(reportFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not create report file: %w", err)
+		}
+		r.file = f
+		r.w = f
+		r.human = true
+		// a report file is always machine readable
+		if r.format == outputText {
+			r.format = outputJSON
+		}
+	}
+
+	if r.format == outputNDJSON {
+		r.ndjson = report.NewNDJSONWriter(r.w)
+	}
+
+	return r, nil
+}
+
+// attach hooks the reporter into the comparison so that the NDJSON events are
+// written as soon as each table completes.
+func (r *reporter) attach(opts *store.CompareOptions) {
+	if r.ndjson == nil {
+		return
+	}
+
+	opts.OnTableComplete = func(t *store.TableResult) {
+		if err := r.ndjson.WriteTable(t); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+}
+
+// finish writes the final report and the human readable summary, then closes
+// the report file. The result can be partial if the comparison failed.
+func (r *reporter) finish(result *store.CompareResult, opts store.CompareOptions) error {
+	rep := report.New(result, opts, r.startedAt)
+
+	switch r.format {
+	case outputJSON:
+		if err := report.WriteJSON(r.w, rep); err != nil && r.err == nil {
+			r.err = err
+		}
+	case outputNDJSON:
+		if err := r.ndjson.WriteSummary(rep); err != nil && r.err == nil {
+			r.err = err
+		}
+	case outputHTML:
+		if err := report.WriteHTML(r.w, rep); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+
+	if r.file != nil {
+		if err := r.file.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+
+	if r.err != nil {
+		return fmt.Errorf("could not write report: %w", r.err)
+	}
+
+	return nil
+}
+
+func printSummary(result *store.CompareResult) {
+	mismatches := result.Mismatches()
+
+	// the tables existing on one side only are reported even if they
+	// are not failing the comparison.
+	failing := make(map[*store.TableResult]bool, len(mismatches))
+	for _, t := range mismatches {
+		failing[t] = true
+	}
+	for _, t := range result.Tables {
+		if failing[t] {
+			continue
+		}
+		switch t.Status {
+		case store.TableStatusMissingInTarget:
+			fmt.Printf("Table %s exists in the source only.\n", t.TableName)
+		case store.TableStatusExtraInTarget:
+			fmt.Printf("Table %s exists in the target only.\n", t.TableName)
+		}
+	}
+
+	if result.SourceSnapshot != nil || result.TargetSnapshot != nil {
+		fmt.Printf("Tables are read from snapshots at source: %s, target: %s.\n", positionOrUnknown(result.SourceSnapshot), positionOrUnknown(result.TargetSnapshot))
+	}
+
+	for _, t := range result.Tables {
+		if t.Retries > 0 {
+			fmt.Printf("Table %s needed %d retried queries.\n", t.TableName, t.Retries)
+		}
+		if t.Reverification != nil && !t.Reverification.Persistent {
+			fmt.Printf("Table %s mismatches %s.\n", t.TableName, t.Reverification)
+		}
+	}
+
+	if result.Incomplete {
+		fmt.Printf("Comparison was interrupted after %d tables, the report is incomplete.\n", len(result.Tables))
+	}
+
+	if len(mismatches) == 0 {
+		if !result.Incomplete {
+			fmt.Println("Database values are same.")
+		}
+		return
+	}
+
+	tables := make([]string, len(mismatches))
+	for i := range mismatches {
+		tables[i] = mismatches[i].TableName
+	}
+	fmt.Printf("Database values differ. Tables: %s\n", strings.Join(tables, ", "))
+
+	for _, t := range mismatches {
+		fmt.Printf("  %s: %s (source rows: %d, target rows: %d)\n", t.TableName, t.Status, t.SourceRows, t.TargetRows)
+		if t.Error != nil {
+			fmt.Printf("    error: %s\n", t.Error)
+		}
+		if t.Reverification != nil {
+			fmt.Printf("    re-verification: %s\n", t.Reverification)
+		}
+		if result.SourceSnapshot == nil && (t.SourceSnapshot != nil || t.TargetSnapshot != nil) {
+			fmt.Printf("    snapshots: source %s, target %s\n", positionOrUnknown(t.SourceSnapshot), positionOrUnknown(t.TargetSnapshot))
+		}
+		if t.FirstMismatch != nil {
+			fmt.Printf("    first mismatch: %s\n", t.FirstMismatch)
+		}
+		for _, r := range t.MismatchedSplits {
+			fmt.Printf("    split: %s\n", r)
+		}
+		for _, r := range t.MismatchedRanges {
+			fmt.Printf("    range: %s\n", r)
+		}
+		if len(t.MismatchedBuckets) > 0 {
+			fmt.Printf("    mismatched buckets: %v\n", t.MismatchedBuckets)
+		}
+	}
+}
+
+// positionOrUnknown returns the position of a snapshot, the position is
+// unknown if the server keeps no binary log or it's not visible to the user.
+func positionOrUnknown(p *store.SnapshotPosition) string {
+	if s := p.String(); s != "" {
+		return s
+	}
+
+	return "unknown"
+}
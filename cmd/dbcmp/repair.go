@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func repairCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Generates the SQL statements to bring the target in line with the source",
+		Long:  "repair finds the differing rows and writes the INSERT, UPDATE and DELETE statements in the dialect of the target database. The target is not modified.",
+		RunE:  runRepairCmdFn,
+	}
+
+	cmd.Flags().Bool("dry-run", false, "only generate the statements without applying them, currently required.")
+	cmd.Flags().String("sql-file", "", "write the statements into the given file instead of stdout.")
+
+	return cmd
+}
+
+func runRepairCmdFn(cmd *cobra.Command, args []string) error {
+	source, target, err := dsnFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := compareOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		return errors.New("repair only supports --dry-run")
+	}
+
+	sqlFile, err := cmd.Flags().GetString("sql-file")
+	if err != nil {
+		return err
+	}
+
+	repairs, warnings, err := store.Repair(cmd.Context(), source, target, opts)
+	printWarnings(warnings)
+	if err != nil {
+		return fmt.Errorf("error during comparison: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if sqlFile != "" {
+		f, err := os.Create(sqlFile)
+		if err != nil {
+			return fmt.Errorf("could not create sql file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	err = writeRepairs(w, repairs)
+	if err != nil {
+		return fmt.Errorf("could not write statements: %w", err)
+	}
+
+	// the summary goes to stderr to keep the statements intact on stdout
+	for _, r := range repairs {
+		fmt.Fprintf(os.Stderr, "%s: %d inserts, %d updates, %d deletes\n", r.TableName, r.Inserts, r.Updates, r.Deletes)
+	}
+	if len(repairs) == 0 {
+		fmt.Fprintln(os.Stderr, "Database values are same.")
+	}
+
+	return nil
+}
+
+func writeRepairs(w io.Writer, repairs []*store.TableRepair) error {
+	for _, r := range repairs {
+		_, err := fmt.Fprintf(w, "-- %s: %d inserts, %d updates, %d deletes\n", r.TableName, r.Inserts, r.Updates, r.Deletes)
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range r.Statements {
+			if _, err := fmt.Fprintln(w, stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
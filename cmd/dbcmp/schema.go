@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func schemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Compares the schemas of the databases",
+		Long:  "schema compares the tables, columns, data types, nullability, defaults, primary keys, unique constraints and indexes. Equivalent MySQL and Postgres data types are not reported.",
+		RunE:  runSchemaCmdFn,
+	}
+}
+
+func runSchemaCmdFn(cmd *cobra.Command, args []string) error {
+	source, target, err := dsnFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := compareOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := store.CompareSchema(source, target, opts)
+	if err != nil {
+		return fmt.Errorf("error during comparison: %w", err)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("Database schemas are same.")
+		return nil
+	}
+
+	fmt.Println("Database schemas differ.")
+	for _, d := range diffs {
+		fmt.Printf("  %s\n", d)
+	}
+	os.Exit(1)
+
+	return nil
+}
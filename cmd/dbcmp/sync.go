@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func syncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Applies the repair statements on the target",
+		Long:  "sync finds the differing rows, applies the INSERT, UPDATE and DELETE statements on the target in batched transactions and verifies the repaired pages afterwards.",
+		RunE:  runSyncCmdFn,
+	}
+
+	cmd.Flags().Bool("apply", false, "apply the statements on the target, required.")
+	cmd.Flags().Bool("yes", false, "apply the statements without asking for a confirmation for each table.")
+	cmd.Flags().Int("batch-size", 100, "number of statements applied in a single transaction.")
+	cmd.Flags().Int("rate-limit", 0, "maximum number of statements applied per second, 0 means no limit.")
+
+	return cmd
+}
+
+func runSyncCmdFn(cmd *cobra.Command, args []string) error {
+	source, target, err := dsnFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := compareOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	apply, err := cmd.Flags().GetBool("apply")
+	if err != nil {
+		return err
+	}
+
+	if !apply {
+		return errors.New("sync modifies the target, it requires --apply. Use repair --dry-run to review the statements first")
+	}
+
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	batchSize, err := cmd.Flags().GetInt("batch-size")
+	if err != nil {
+		return err
+	}
+
+	rateLimit, err := cmd.Flags().GetInt("rate-limit")
+	if err != nil {
+		return err
+	}
+
+	if rateLimit < 0 {
+		return fmt.Errorf("rate limit could not be negative, current value is: %d", rateLimit)
+	}
+
+	syncOpts := store.SyncOptions{
+		BatchSize: batchSize,
+		RateLimit: rateLimit,
+	}
+	if !yes {
+		syncOpts.Confirm = confirmRepair
+	}
+
+	syncs, warnings, err := store.Sync(cmd.Context(), source, target, opts, syncOpts)
+	printWarnings(warnings)
+	mismatches := 0
+	for _, s := range syncs {
+		switch {
+		case s.Skipped:
+			fmt.Printf("%s: skipped\n", s.TableName)
+		case len(s.Mismatches) > 0:
+			mismatches++
+			fmt.Printf("%s: %d inserts, %d updates, %d deletes, still differs in %d pages\n", s.TableName, s.Inserts, s.Updates, s.Deletes, len(s.Mismatches))
+		default:
+			fmt.Printf("%s: %d inserts, %d updates, %d deletes, verified\n", s.TableName, s.Inserts, s.Updates, s.Deletes)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error during sync: %w", err)
+	}
+
+	if len(syncs) == 0 {
+		fmt.Println("Database values are same.")
+	}
+
+	// the target still differs after the repair
+	if code := exitCode(mismatches, 0, false); code != 0 {
+		os.Exit(code)
+	}
+
+	return nil
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func confirmRepair(r *store.TableRepair) bool {
+	fmt.Printf("Apply %d inserts, %d updates, %d deletes on %s? [y/N] ", r.Inserts, r.Updates, r.Deletes, r.TableName)
+
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mattermost/dbcmp/internal/store"
+)
+
+// htmlTmpl is a self contained page, the styles are inlined so that the
+// report can be handed over as a single file.
+const htmlTmpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>dbcmp report</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+  h1 { margin-bottom: 0.2em; }
+  table { border-collapse: collapse; margin: 1em 0; }
+  th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; vertical-align: top; }
+  th { background: #f4f4f4; }
+  td.num { text-align: right; }
+  .verdict { display: inline-block; padding: 0.4em 1em; border-radius: 4px; font-weight: bold; color: #fff; }
+  .same { background: #2e7d32; }
+  .differ { background: #c62828; }
+  .status-match { color: #2e7d32; }
+  .status-error { color: #c62828; font-weight: bold; }
+  .status-mismatch { color: #c62828; }
+  code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Database comparison report</h1>
+{{ if .Equal }}<p class="verdict same">Database values are same</p>{{ else if .Incomplete }}<p class="verdict differ">Comparison was interrupted, the report is incomplete</p>{{ else }}<p class="verdict differ">Database values differ</p>{{ end }}
+
+<h2>Run</h2>
+<table>
+  <tr><th></th><th>Source</th><th>Target</th></tr>
+  <tr><th>Driver</th><td>{{ .Source.Driver }}</td><td>{{ .Target.Driver }}</td></tr>
+  <tr><th>Host</th><td>{{ .Source.Host }}</td><td>{{ .Target.Host }}</td></tr>
+  <tr><th>Database</th><td>{{ .Source.Database }}</td><td>{{ .Target.Database }}</td></tr>
+  <tr><th>Version</th><td>{{ .Source.Version }}</td><td>{{ .Target.Version }}</td></tr>
+{{ if or .SourceSnapshot .TargetSnapshot }}  <tr><th>Snapshot</th><td>{{ .SourceSnapshot }}</td><td>{{ .TargetSnapshot }}</td></tr>
+{{ end }}</table>
+<table>
+  <tr><th>Started at</th><td>{{ .StartedAt.Format "2006-01-02 15:04:05 MST" }}</td></tr>
+  <tr><th>Elapsed</th><td>{{ duration .ElapsedMs }}</td></tr>
+  <tr><th>Page size</th><td>{{ .Options.PageSize }}</td></tr>
+  <tr><th>Tables compared</th><td>{{ len .Tables }}</td></tr>
+  <tr><th>Excluded tables</th><td>{{ if .Excluded }}{{ join .Excluded ", " }}{{ else }}-{{ end }}</td></tr>
+</table>
+{{ if .Warnings }}
+<h2>Warnings</h2>
+<ul>
+{{ range .Warnings }}  <li>{{ . }}</li>
+{{ end }}</ul>
+{{ end }}
+<h2>Tables</h2>
+<table>
+  <tr><th>Table</th><th>Status</th><th>Source rows</th><th>Target rows</th><th>Pages checked</th><th>Mismatched ranges</th><th>Elapsed</th><th>Notes</th></tr>
+{{ range .Tables }}  <tr>
+    <td>{{ .Name }}</td>
+    <td class="{{ statusClass .Status }}">{{ .Status }}</td>
+    <td class="num">{{ .SourceRows }}</td>
+    <td class="num">{{ .TargetRows }}</td>
+    <td class="num">{{ .PagesChecked }}</td>
+    <td>{{ if .MismatchedRanges }}{{ range .MismatchedRanges }}<code>{{ . }}</code><br>{{ end }}{{ else if .FirstMismatch }}<code>{{ .FirstMismatch }}</code>{{ else if .MismatchedBuckets }}buckets {{ .MismatchedBuckets }}{{ end }}{{ range .MismatchedSplits }}<br>split <code>{{ . }}</code>{{ end }}</td>
+    <td>{{ duration .ElapsedMs }}</td>
+    <td>{{ if .Error }}{{ .Error }}<br>{{ end }}{{ if .QueryError }}<code>{{ .QueryError.Query }}</code><br>{{ end }}{{ if .Reverification }}re-verification: {{ .Reverification.Outcome }}<br>{{ end }}{{ range .Warnings }}{{ . }}<br>{{ end }}</td>
+  </tr>
+{{ end }}</table>
+</body>
+</html>
+`
+
+var htmlFuncs = template.FuncMap{
+	"join": strings.Join,
+	"duration": func(ms int64) string {
+		return (time.Duration(ms) * time.Millisecond).String()
+	},
+	"statusClass": func(status store.TableStatus) string {
+		switch status {
+		case store.TableStatusMatch:
+			return "status-match"
+		case store.TableStatusError:
+			return "status-error"
+		default:
+			return "status-mismatch"
+		}
+	},
+}
+
+// String returns the range in the (from, to] notation.
+func (r KeyRange) String() string {
+	return store.KeyRange{From: r.From, To: r.To}.String()
+}
+
+// WriteHTML writes the report as a single HTML page without external assets.
+func WriteHTML(w io.Writer, r *Report) error {
+	t, err := template.New("report").Funcs(htmlFuncs).Parse(htmlTmpl)
+	if err != nil {
+		return fmt.Errorf("could not parse template: %w", err)
+	}
+
+	return t.Execute(w, r)
+}
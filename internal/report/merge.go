@@ -0,0 +1,228 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/dbcmp/internal/store"
+)
+
+// statusRanks orders the statuses by their severity, the most severe status of
+// a table wins when the partial reports are merged.
+var statusRanks = map[store.TableStatus]int{
+	store.TableStatusMatch:            0,
+	store.TableStatusMissingInTarget:  1,
+	store.TableStatusExtraInTarget:    1,
+	store.TableStatusChecksumMismatch: 2,
+	store.TableStatusCountMismatch:    3,
+	store.TableStatusSchemaMismatch:   4,
+	store.TableStatusError:            5,
+}
+
+// Mismatches returns the tables that fail the comparison. The missing and
+// extra tables are left out unless they are set to fail the run by the
+// options.
+func (r *Report) Mismatches() []Table {
+	var mismatches []Table
+	for _, t := range r.Tables {
+		switch {
+		case t.Status == store.TableStatusMatch:
+		case t.Status == store.TableStatusMissingInTarget && r.Options.AllowMissingTables:
+		case t.Status == store.TableStatusExtraInTarget && !r.Options.FailOnExtraTables:
+		default:
+			mismatches = append(mismatches, t)
+		}
+	}
+
+	return mismatches
+}
+
+// Errors returns the tables that could not be compared, they are among the
+// Mismatches as well.
+func (r *Report) Errors() []Table {
+	var errs []Table
+	for _, t := range r.Tables {
+		if t.Status == store.TableStatusError {
+			errs = append(errs, t)
+		}
+	}
+
+	return errs
+}
+
+// Merge combines the partial reports of all shards of a comparison into a
+// single report. Each shard must be given exactly once and the reports must
+// belong to the same databases. The tables compared by more than one shard are
+// merged, their most severe status wins. The merged report is incomplete if
+// any of the shards is. Each shard reads from its own snapshots, their
+// positions are kept on the tables only.
+func Merge(reports []*Report) (*Report, error) {
+	if len(reports) == 0 {
+		return nil, errors.New("no reports to merge")
+	}
+
+	first := reports[0]
+	if first.Options.Shard == nil {
+		return nil, errors.New("the report is not a partial report of a shard")
+	}
+
+	seen := make(map[int]bool, len(reports))
+	for _, r := range reports {
+		switch {
+		case r.Options.Shard == nil:
+			return nil, errors.New("the report is not a partial report of a shard")
+		case r.Options.Shard.Count != first.Options.Shard.Count:
+			return nil, fmt.Errorf("shard %s does not belong to the comparison of %d shards", r.Options.Shard, first.Options.Shard.Count)
+		case r.Options.ShardKeyRanges != first.Options.ShardKeyRanges:
+			return nil, fmt.Errorf("shard %s is sharded differently", r.Options.Shard)
+		case seen[r.Options.Shard.Index]:
+			return nil, fmt.Errorf("shard %s is given more than once", r.Options.Shard)
+		case r.Source.Host != first.Source.Host || r.Source.Database != first.Source.Database:
+			return nil, fmt.Errorf("shard %s has a different source database", r.Options.Shard)
+		case r.Target.Host != first.Target.Host || r.Target.Database != first.Target.Database:
+			return nil, fmt.Errorf("shard %s has a different target database", r.Options.Shard)
+		}
+		seen[r.Options.Shard.Index] = true
+	}
+
+	for i := 1; i <= first.Options.Shard.Count; i++ {
+		if !seen[i] {
+			return nil, fmt.Errorf("the report of shard %d/%d is missing", i, first.Options.Shard.Count)
+		}
+	}
+
+	merged := &Report{
+		StartedAt: first.StartedAt,
+		Source:    first.Source,
+		Target:    first.Target,
+		Options:   first.Options,
+	}
+	merged.Options.Shard = nil
+	merged.Options.ShardKeyRanges = false
+
+	tables := make(map[string]*Table)
+	excluded := make(map[string]struct{})
+	warnings := make(map[string]struct{})
+	for _, r := range reports {
+		if r.StartedAt.Before(merged.StartedAt) {
+			merged.StartedAt = r.StartedAt
+		}
+		if r.ElapsedMs > merged.ElapsedMs {
+			merged.ElapsedMs = r.ElapsedMs
+		}
+		merged.Incomplete = merged.Incomplete || r.Incomplete
+
+		for _, t := range r.Tables {
+			k := strings.ToLower(t.Name)
+			if m, ok := tables[k]; ok {
+				mergeTable(m, t)
+				continue
+			}
+			t := t
+			tables[k] = &t
+		}
+
+		for _, e := range r.Excluded {
+			if _, ok := excluded[e]; !ok {
+				excluded[e] = struct{}{}
+				merged.Excluded = append(merged.Excluded, e)
+			}
+		}
+
+		for _, w := range r.Warnings {
+			if _, ok := warnings[w]; !ok {
+				warnings[w] = struct{}{}
+				merged.Warnings = append(merged.Warnings, w)
+			}
+		}
+	}
+	sort.Strings(merged.Excluded)
+
+	names := make([]string, 0, len(tables))
+	for k := range tables {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	merged.Tables = make([]Table, 0, len(names))
+	for _, k := range names {
+		merged.Tables = append(merged.Tables, *tables[k])
+	}
+	merged.Equal = !merged.Incomplete && len(merged.Mismatches()) == 0
+
+	return merged, nil
+}
+
+// mergeTable merges the report of a table by another shard into t.
+func mergeTable(t *Table, other Table) {
+	if statusRanks[other.Status] > statusRanks[t.Status] {
+		t.Status = other.Status
+	}
+
+	if other.SourceRows > t.SourceRows {
+		t.SourceRows = other.SourceRows
+	}
+	if other.TargetRows > t.TargetRows {
+		t.TargetRows = other.TargetRows
+	}
+	if other.ElapsedMs > t.ElapsedMs {
+		t.ElapsedMs = other.ElapsedMs
+	}
+
+	t.PagesChecked += other.PagesChecked
+	t.Retries += other.Retries
+	if t.FirstMismatch == nil {
+		t.FirstMismatch = other.FirstMismatch
+	}
+	t.MismatchedRanges = append(t.MismatchedRanges, other.MismatchedRanges...)
+	t.MismatchedBuckets = append(t.MismatchedBuckets, other.MismatchedBuckets...)
+	t.MismatchedSplits = append(t.MismatchedSplits, other.MismatchedSplits...)
+
+	for _, w := range other.Warnings {
+		found := false
+		for _, existing := range t.Warnings {
+			if existing == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Warnings = append(t.Warnings, w)
+		}
+	}
+
+	switch {
+	case other.Error == "":
+	case t.Error == "":
+		t.Error = other.Error
+	default:
+		t.Error = t.Error + "; " + other.Error
+	}
+	if t.QueryError == nil {
+		t.QueryError = other.QueryError
+	}
+
+	switch {
+	case other.Reverification == nil:
+	case t.Reverification == nil:
+		t.Reverification = other.Reverification
+	default:
+		v := *t.Reverification
+		if other.Reverification.Retries > v.Retries {
+			v.Retries = other.Reverification.Retries
+		}
+		v.Persistent = v.Persistent || other.Reverification.Persistent
+		v.Converged = append(append([]KeyRange(nil), v.Converged...), other.Reverification.Converged...)
+		v.Outcome = reverificationOutcome(v.Retries, v.Persistent)
+		t.Reverification = &v
+	}
+}
+
+// reverificationOutcome returns the label of a merged re-verification, it
+// matches the label of store.Reverification.
+func reverificationOutcome(retries int, persistent bool) string {
+	v := store.Reverification{Retries: retries, Persistent: persistent}
+	return v.String()
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	partial := func(index int, tables ...Table) *Report {
+		var buf bytes.Buffer
+		err := WriteJSON(&buf, &Report{
+			Equal:     true,
+			StartedAt: time.Date(2023, 7, 1, 10, index, 0, 0, time.UTC),
+			ElapsedMs: int64(index * 1000),
+			Source:    store.DatabaseInfo{Driver: "mysql", Host: "db1", Database: "mattermost"},
+			Target:    store.DatabaseInfo{Driver: "postgres", Host: "db2", Database: "mattermost"},
+			Options: store.CompareOptions{
+				PageSize:       20,
+				Shard:          &store.Shard{Index: index, Count: 2},
+				ShardKeyRanges: true,
+			},
+			Tables:   tables,
+			Warnings: []string{"target: could not get version"},
+		})
+		require.NoError(t, err)
+
+		r, err := ReadJSON(&buf)
+		require.NoError(t, err)
+		return r
+	}
+
+	r1 := partial(1,
+		Table{Name: "Posts", Status: store.TableStatusMatch, SourceRows: 10, TargetRows: 10, PagesChecked: 2},
+		Table{Name: "Users", Status: store.TableStatusMatch, SourceRows: 5, TargetRows: 5, PagesChecked: 1},
+	)
+	r2 := partial(2,
+		Table{Name: "Posts", Status: store.TableStatusChecksumMismatch, SourceRows: 10, TargetRows: 10, PagesChecked: 3,
+			MismatchedSplits: []KeyRange{{From: []any{"b"}}}},
+		Table{Name: "Channels", Status: store.TableStatusExtraInTarget, TargetRows: 3},
+	)
+
+	merged, err := Merge([]*Report{r2, r1})
+	require.NoError(t, err)
+	require.False(t, merged.Equal)
+	require.Nil(t, merged.Options.Shard)
+	require.Equal(t, int64(2000), merged.ElapsedMs)
+	require.Equal(t, r1.StartedAt, merged.StartedAt)
+	require.Equal(t, []string{"target: could not get version"}, merged.Warnings)
+
+	require.Len(t, merged.Tables, 3)
+	require.Equal(t, "Channels", merged.Tables[0].Name)
+	require.Equal(t, "Posts", merged.Tables[1].Name)
+	require.Equal(t, store.TableStatusChecksumMismatch, merged.Tables[1].Status)
+	require.Equal(t, 5, merged.Tables[1].PagesChecked)
+	require.Len(t, merged.Tables[1].MismatchedSplits, 1)
+	require.Len(t, merged.Mismatches(), 1)
+
+	_, err = Merge([]*Report{r1})
+	require.ErrorContains(t, err, "shard 2/2 is missing")
+
+	_, err = Merge([]*Report{r1, r1})
+	require.ErrorContains(t, err, "more than once")
+
+	r2.Target.Host = "db3"
+	_, err = Merge([]*Report{r1, r2})
+	require.ErrorContains(t, err, "different target")
+}
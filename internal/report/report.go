@@ -0,0 +1,224 @@
+// Package report renders the results of a comparison in machine readable
+// formats.
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/mattermost/dbcmp/internal/store"
+)
+
+const (
+	EventTypeTable   = "table"
+	EventTypeSummary = "summary"
+)
+
+// Report is the final report document of a comparison.
+type Report struct {
+	Equal     bool                 `json:"equal"`
+	StartedAt time.Time            `json:"started_at"`
+	ElapsedMs int64                `json:"elapsed_ms"`
+	Source    store.DatabaseInfo   `json:"source"`
+	Target    store.DatabaseInfo   `json:"target"`
+	Options   store.CompareOptions `json:"options"`
+	Tables    []Table              `json:"tables,omitempty"`
+	Excluded  []string             `json:"excluded,omitempty"`
+	Warnings  []string             `json:"warnings,omitempty"`
+	// Incomplete means the comparison was interrupted, only the tables
+	// completed by then are reported.
+	Incomplete bool `json:"incomplete,omitempty"`
+	// SourceSnapshot and TargetSnapshot are the positions of the snapshots
+	// all tables were read from, if any.
+	SourceSnapshot *store.SnapshotPosition `json:"source_snapshot,omitempty"`
+	TargetSnapshot *store.SnapshotPosition `json:"target_snapshot,omitempty"`
+}
+
+// Table is the report of a single table.
+type Table struct {
+	Name              string            `json:"name"`
+	Status            store.TableStatus `json:"status"`
+	SourceRows        int               `json:"source_rows"`
+	TargetRows        int               `json:"target_rows"`
+	PagesChecked      int               `json:"pages_checked"`
+	FirstMismatch     *KeyRange         `json:"first_mismatch,omitempty"`
+	MismatchedRanges  []KeyRange        `json:"mismatched_ranges,omitempty"`
+	MismatchedBuckets []int             `json:"mismatched_buckets,omitempty"`
+	MismatchedSplits  []KeyRange        `json:"mismatched_splits,omitempty"`
+	ElapsedMs         int64             `json:"elapsed_ms"`
+	Retries           int               `json:"retries,omitempty"`
+	Warnings          []string          `json:"warnings,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	// QueryError is the failing query of the error, if any.
+	QueryError *QueryError `json:"query_error,omitempty"`
+	// SourceSnapshot and TargetSnapshot are the positions of the snapshots
+	// the table was read from, if any.
+	SourceSnapshot *store.SnapshotPosition `json:"source_snapshot,omitempty"`
+	TargetSnapshot *store.SnapshotPosition `json:"target_snapshot,omitempty"`
+	// Reverification is the outcome of re-checking the mismatches, if any.
+	Reverification *Reverification `json:"reverification,omitempty"`
+}
+
+// Reverification is the outcome of re-checking the mismatches of a table. The
+// outcome is either "persistent" or "converged after N retries".
+type Reverification struct {
+	Outcome    string     `json:"outcome"`
+	Retries    int        `json:"retries"`
+	Persistent bool       `json:"persistent"`
+	Converged  []KeyRange `json:"converged,omitempty"`
+}
+
+// QueryError is the failing query of a table that could not be compared.
+type QueryError struct {
+	Dialect string `json:"dialect"`
+	Query   string `json:"query"`
+	Cause   string `json:"cause"`
+}
+
+// KeyRange is a range of primary key values, From is exclusive and To is
+// inclusive. A null value means the range is unbounded on that side.
+type KeyRange struct {
+	From []any `json:"from"`
+	To   []any `json:"to"`
+}
+
+// Event is a single line of a NDJSON report. It either contains the report of
+// a table or the summary of the comparison.
+type Event struct {
+	Type    string  `json:"type"`
+	Table   *Table  `json:"table,omitempty"`
+	Summary *Report `json:"summary,omitempty"`
+}
+
+// New creates a report from the result of a comparison.
+func New(result *store.CompareResult, opts store.CompareOptions, startedAt time.Time) *Report {
+	r := &Report{
+		Equal:          result.Equal(),
+		StartedAt:      startedAt,
+		ElapsedMs:      result.Elapsed.Milliseconds(),
+		Source:         result.Source,
+		Target:         result.Target,
+		Options:        opts,
+		Tables:         make([]Table, 0, len(result.Tables)),
+		Excluded:       result.Excluded,
+		Warnings:       result.Warnings,
+		Incomplete:     result.Incomplete,
+		SourceSnapshot: result.SourceSnapshot,
+		TargetSnapshot: result.TargetSnapshot,
+	}
+
+	for _, t := range result.Tables {
+		r.Tables = append(r.Tables, NewTable(t))
+	}
+
+	return r
+}
+
+// NewTable creates the report of a single table.
+func NewTable(t *store.TableResult) Table {
+	table := Table{
+		Name:              t.TableName,
+		Status:            t.Status,
+		SourceRows:        t.SourceRows,
+		TargetRows:        t.TargetRows,
+		PagesChecked:      t.PagesChecked,
+		ElapsedMs:         t.Elapsed.Milliseconds(),
+		Retries:           t.Retries,
+		SourceSnapshot:    t.SourceSnapshot,
+		TargetSnapshot:    t.TargetSnapshot,
+		Warnings:          t.Warnings,
+		MismatchedBuckets: t.MismatchedBuckets,
+	}
+
+	if t.FirstMismatch != nil {
+		table.FirstMismatch = &KeyRange{From: t.FirstMismatch.From, To: t.FirstMismatch.To}
+	}
+
+	for _, r := range t.MismatchedRanges {
+		table.MismatchedRanges = append(table.MismatchedRanges, KeyRange{From: r.From, To: r.To})
+	}
+
+	for _, r := range t.MismatchedSplits {
+		table.MismatchedSplits = append(table.MismatchedSplits, KeyRange{From: r.From, To: r.To})
+	}
+
+	if t.Error != nil {
+		table.Error = t.Error.Error()
+	}
+
+	if v := t.Reverification; v != nil {
+		table.Reverification = &Reverification{
+			Outcome:    v.String(),
+			Retries:    v.Retries,
+			Persistent: v.Persistent,
+		}
+		for _, r := range v.Converged {
+			table.Reverification.Converged = append(table.Reverification.Converged, KeyRange{From: r.From, To: r.To})
+		}
+	}
+
+	var queryErr *store.QueryError
+	if errors.As(t.Error, &queryErr) {
+		table.QueryError = &QueryError{
+			Dialect: queryErr.Dialect,
+			Query:   queryErr.Query,
+			Cause:   queryErr.Err.Error(),
+		}
+	}
+
+	return table
+}
+
+// WriteJSON writes the report as an indented JSON document.
+func WriteJSON(w io.Writer, r *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// ReadJSON reads a report written by WriteJSON.
+func ReadJSON(r io.Reader) (*Report, error) {
+	var rep Report
+	if err := json.NewDecoder(r).Decode(&rep); err != nil {
+		return nil, err
+	}
+
+	return &rep, nil
+}
+
+// NDJSONWriter writes a report as newline delimited JSON events. Each table is
+// written as soon as its comparison completes and the summary is written last.
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter creates a NDJSONWriter writing into w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// WriteTable writes the event of a completed table.
+func (w *NDJSONWriter) WriteTable(t *store.TableResult) error {
+	table := NewTable(t)
+	return w.enc.Encode(Event{
+		Type:  EventTypeTable,
+		Table: &table,
+	})
+}
+
+// WriteSummary writes the summary event, the tables are left out since they
+// are already written.
+func (w *NDJSONWriter) WriteSummary(r *Report) error {
+	summary := *r
+	summary.Tables = nil
+
+	return w.enc.Encode(Event{
+		Type:    EventTypeSummary,
+		Summary: &summary,
+	})
+}
@@ -0,0 +1,107 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mattermost/dbcmp/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult() *store.CompareResult {
+	return &store.CompareResult{
+		Elapsed: 3 * time.Second,
+		Tables: []*store.TableResult{
+			{
+				TableName:    "Table1",
+				Status:       store.TableStatusMatch,
+				SourceRows:   10,
+				TargetRows:   10,
+				PagesChecked: 1,
+				Elapsed:      time.Second,
+			},
+			{
+				TableName:     "Table2",
+				Status:        store.TableStatusChecksumMismatch,
+				SourceRows:    10,
+				TargetRows:    10,
+				PagesChecked:  2,
+				FirstMismatch: &store.KeyRange{From: []any{"a", "b"}},
+				Elapsed:       2 * time.Second,
+			},
+			{
+				TableName: "Table3",
+				Status:    store.TableStatusError,
+				Error:     errors.New("could not count rows"),
+			},
+		},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	opts := store.CompareOptions{PageSize: 20}
+	var buf bytes.Buffer
+	err := WriteJSON(&buf, New(testResult(), opts, time.Now()))
+	require.NoError(t, err)
+
+	var r Report
+	err = json.Unmarshal(buf.Bytes(), &r)
+	require.NoError(t, err)
+
+	require.False(t, r.Equal)
+	require.Equal(t, int64(3000), r.ElapsedMs)
+	require.Equal(t, 20, r.Options.PageSize)
+	require.Len(t, r.Tables, 3)
+	require.Equal(t, store.TableStatusChecksumMismatch, r.Tables[1].Status)
+	require.Equal(t, []any{"a", "b"}, r.Tables[1].FirstMismatch.From)
+	require.Nil(t, r.Tables[1].FirstMismatch.To)
+	require.Equal(t, "could not count rows", r.Tables[2].Error)
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	result := testResult()
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	for _, table := range result.Tables {
+		require.NoError(t, w.WriteTable(table))
+	}
+	require.NoError(t, w.WriteSummary(New(result, store.CompareOptions{}, time.Now())))
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 4)
+
+	for _, e := range events[:3] {
+		require.Equal(t, EventTypeTable, e.Type)
+		require.NotNil(t, e.Table)
+	}
+	require.Equal(t, EventTypeSummary, events[3].Type)
+	require.Empty(t, events[3].Summary.Tables)
+}
+
+func TestWriteHTML(t *testing.T) {
+	result := testResult()
+	result.Source = store.DatabaseInfo{Driver: "mysql", Host: "localhost:3306", Database: "mm", Version: "8.0.33"}
+	result.Excluded = []string{"Sessions"}
+
+	var buf bytes.Buffer
+	err := WriteHTML(&buf, New(result, store.CompareOptions{PageSize: 20}, time.Now()))
+	require.NoError(t, err)
+
+	html := buf.String()
+	require.Contains(t, html, "Database values differ")
+	require.Contains(t, html, "8.0.33")
+	require.Contains(t, html, "Sessions")
+	require.Contains(t, html, "((a, b), &#43;inf]")
+	require.NotContains(t, html, "<link")
+	require.NotContains(t, html, "<script")
+}
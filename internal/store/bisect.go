@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// KeyRange is a range of primary key values. From is exclusive and To is
+// inclusive, a nil value means the range is unbounded on that side.
+type KeyRange struct {
+	From []any
+	To   []any
+}
+
+func (r KeyRange) String() string {
+	from, to := "-inf", "+inf"
+	if r.From != nil {
+		from = formatKey(r.From)
+	}
+	if r.To != nil {
+		to = formatKey(r.To)
+	}
+
+	return fmt.Sprintf("(%s, %s]", from, to)
+}
+
+// bisectPage splits a mismatching page into halves and checksums each half on
+// both sides, recursing into the halves that differ. It returns the key ranges
+// that differ and contain no more than minSize rows in the source. Since only
+// the checksum templates are used, no rows are transferred to the client.
+func bisectPage(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, page cursorData, minSize int) ([]KeyRange, error) {
+	size, err := srcdb.countRange(ctx, src, page)
+	if err != nil {
+		return nil, fmt.Errorf("could not count src rows: %w", err)
+	}
+
+	return bisectRange(ctx, srcdb, dstdb, src, dst, page, size, minSize)
+}
+
+func bisectRange(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, page cursorData, size, minSize int) ([]KeyRange, error) {
+	if size <= minSize || size < 2 {
+		return []KeyRange{{From: page.cursors, To: page.upper}}, nil
+	}
+
+	// the middle key is determined by the source, the first half is
+	// checksummed along with it.
+	half := size / 2
+	srcChecksum, next, err := srcdb.checksum(ctx, src, cursorData{
+		cursors: page.cursors,
+		upper:   page.upper,
+		limit:   half,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not compute src checksum: %w", err)
+	}
+
+	// if the source has shrunk, the first half reaches the end of the page
+	// and there is no second half.
+	left := cursorData{cursors: page.cursors, upper: next.cursors}
+	if next.cursors == nil {
+		left.upper = page.upper
+	}
+
+	dstChecksum, _, err := dstdb.checksum(ctx, dst, left)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute dst checksum: %w", err)
+	}
+
+	var ranges []KeyRange
+	if srcChecksum != dstChecksum {
+		r, err := bisectRange(ctx, srcdb, dstdb, src, dst, left, half, minSize)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r...)
+	}
+
+	if next.cursors == nil {
+		return ranges, nil
+	}
+
+	right := cursorData{cursors: next.cursors, upper: page.upper}
+	srcChecksum, _, err = srcdb.checksum(ctx, src, right)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute src checksum: %w", err)
+	}
+
+	dstChecksum, _, err = dstdb.checksum(ctx, dst, right)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute dst checksum: %w", err)
+	}
+
+	if srcChecksum != dstChecksum {
+		r, err := bisectRange(ctx, srcdb, dstdb, src, dst, right, size-half, minSize)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r...)
+	}
+
+	// the halves can't both be equal unless the checksums collide, in that
+	// case we report the range as a whole.
+	if len(ranges) == 0 {
+		return []KeyRange{{From: page.cursors, To: page.upper}}, nil
+	}
+
+	return ranges, nil
+}
+
+func formatKey(keys []any) string {
+	s := make([]string, len(keys))
+	for i := range keys {
+		s[i] = fmt.Sprint(keys[i])
+	}
+
+	if len(s) == 1 {
+		return s[0]
+	}
+
+	return "(" + strings.Join(s, ", ") + ")"
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Partitioning is the way the tables are split up to compare the checksums.
+type Partitioning string
+
+const (
+	// PartitioningPages walks the tables in the order of their primary keys
+	// page by page.
+	PartitioningPages Partitioning = "pages"
+	// PartitioningBuckets groups the rows into a fixed number of buckets by
+	// the hash of their primary keys, so it doesn't depend on the order of
+	// the keys at all.
+	PartitioningBuckets Partitioning = "buckets"
+)
+
+// keyColumns returns the columns of the primary keys in the order of the keys.
+func keyColumns(table *TableInfo) ([]*ColumnInfo, error) {
+	columns := make(map[string]*ColumnInfo, len(table.Columns))
+	for _, c := range table.Columns {
+		columns[strings.ToLower(c.ColumnName)] = c
+	}
+
+	keys := make([]*ColumnInfo, len(table.PrimaryKeys))
+	for i, pk := range table.PrimaryKeys {
+		c, ok := columns[strings.ToLower(pk)]
+		if !ok {
+			return nil, fmt.Errorf("could not find the primary key column %q", pk)
+		}
+		keys[i] = c
+	}
+
+	return keys, nil
+}
+
+// intersectBuckets returns the buckets in both of the sorted lists.
+func intersectBuckets(a, b []int) []int {
+	var both []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+
+	return both
+}
+
+// bucketChecksums returns the checksums of the rows of the table grouped into
+// the given number of buckets. The empty buckets are left out.
+func (db *DB) bucketChecksums(ctx context.Context, table *TableInfo, buckets int) (map[int]string, error) {
+	keys, err := keyColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows of the tables without keys are bucketed by all of their columns
+	if len(keys) == 0 {
+		keys = table.Columns
+	}
+
+	q := struct {
+		TableName     string
+		KeyQuery      string
+		ColumnQuery   string
+		CurrentSchema string
+		Buckets       int
+	}{
+		TableName:   table.TableName,
+		KeyQuery:    generateQueryForColumns(db.dbType, keys),
+		ColumnQuery: generateQueryForColumns(db.dbType, table.Columns),
+		Buckets:     buckets,
+	}
+
+	var tmpl string
+	switch db.dbType {
+	case DatabaseDriverMysql:
+		tmpl = MySQLBucketChecksumTmpl
+	case DatabaseDriverPostgres:
+		tmpl = PostgresBucketChecksumTmpl
+		currentSchema, err := db.currentSchema()
+		if err != nil {
+			return nil, err
+		}
+		q.CurrentSchema = currentSchema
+	default:
+		return nil, fmt.Errorf("unrecognized database driver: %s", db.dbType)
+	}
+
+	t, err := template.New("query").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	out := bytes.NewBufferString("")
+	err = t.Execute(out, q)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute template: %w", err)
+	}
+
+	var checksums map[int]string
+	err = db.retry(ctx, table.TableName, out.String(), func() error {
+		checksums = make(map[int]string)
+		rows, err := db.conn().QueryxContext(ctx, db.tagged(out.String()))
+		if err != nil {
+			return fmt.Errorf("could not select bucket checksums: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ints = struct {
+				Bucket int           `db:"bucket"`
+				A      sql.NullInt64 `db:"a"`
+				B      sql.NullInt64 `db:"b"`
+				C      sql.NullInt64 `db:"c"`
+				D      sql.NullInt64 `db:"d"`
+			}{}
+			if err := rows.StructScan(&ints); err != nil {
+				return fmt.Errorf("could not scan bucket checksum: %w", err)
+			}
+			checksums[ints.Bucket] = fmt.Sprintf("%d%d%d%d", ints.A.Int64, ints.B.Int64, ints.C.Int64, ints.D.Int64)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// compareBuckets returns the buckets whose checksums differ, in order. A bucket
+// that is empty on one side only is reported as well.
+func compareBuckets(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, buckets int) ([]int, error) {
+	var srcChecksums, dstChecksums map[int]string
+	err := concurrently(func() error {
+		var err error
+		srcChecksums, err = srcdb.bucketChecksums(ctx, src, buckets)
+		if err != nil {
+			return fmt.Errorf("could not compute src checksums: %w", err)
+		}
+		return nil
+	}, func() error {
+		var err error
+		dstChecksums, err = dstdb.bucketChecksums(ctx, dst, buckets)
+		if err != nil {
+			return fmt.Errorf("could not compute dst checksums: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatched []int
+	for b, c := range srcChecksums {
+		if dstChecksums[b] != c {
+			mismatched = append(mismatched, b)
+		}
+	}
+	for b := range dstChecksums {
+		if _, ok := srcChecksums[b]; !ok {
+			mismatched = append(mismatched, b)
+		}
+	}
+	sort.Ints(mismatched)
+
+	return mismatched, nil
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// checkpointInterval is the minimum duration between two writes of the state
+// file while the pages are being walked. The completion of a table is always
+// written immediately.
+const checkpointInterval = time.Second
+
+// checkpoint is the progress of a comparison persisted into the state file.
+// The tables are keyed by their lowercase names.
+type checkpoint struct {
+	// Fingerprint identifies the databases and the options of the comparison.
+	Fingerprint string `json:"fingerprint"`
+	// Tables are the results of the completed tables.
+	Tables map[string]*TableResult `json:"tables"`
+	// Splits are the progress of the tables being compared.
+	Splits map[string][]splitOutcome `json:"splits"`
+}
+
+// checkpointer persists the progress of a comparison. The methods of a nil
+// checkpointer do nothing, so that the comparison doesn't need to check
+// whether the checkpoints are enabled.
+type checkpointer struct {
+	path  string
+	mu    sync.Mutex
+	state checkpoint
+	saved time.Time
+}
+
+// openCheckpoint creates the checkpointer writing into the given path. If
+// resume is set, the progress is loaded from the existing state file, which
+// must belong to a comparison with the same fingerprint.
+func openCheckpoint(path, fingerprint string, resume bool) (*checkpointer, error) {
+	c := &checkpointer{
+		path: path,
+		state: checkpoint{
+			Fingerprint: fingerprint,
+			Tables:      make(map[string]*TableResult),
+			Splits:      make(map[string][]splitOutcome),
+		},
+	}
+
+	if !resume {
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state file: %w", err)
+	}
+	defer f.Close()
+
+	// the numbers are kept as they are, a float64 can't hold every key
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+
+	var state checkpoint
+	if err := dec.Decode(&state); err != nil {
+		return nil, fmt.Errorf("could not read state file: %w", err)
+	}
+
+	if state.Fingerprint != fingerprint {
+		return nil, errors.New("the state file belongs to a comparison of other databases or with other options")
+	}
+
+	if state.Tables != nil {
+		c.state.Tables = state.Tables
+	}
+	if state.Splits != nil {
+		c.state.Splits = state.Splits
+	}
+
+	return c, nil
+}
+
+// result returns the result of the table if it's already completed.
+func (c *checkpointer) result(table string) *TableResult {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state.Tables[table]
+}
+
+// splits returns the progress of the splits of the table, if any.
+func (c *checkpointer) splits(table string) []splitOutcome {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	outcomes := c.state.Splits[table]
+	if outcomes == nil {
+		return nil
+	}
+
+	return append([]splitOutcome(nil), outcomes...)
+}
+
+// startSplits records the splits of the table before they are walked.
+func (c *checkpointer) startSplits(table string, outcomes []splitOutcome) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Splits[table] = append([]splitOutcome(nil), outcomes...)
+	return c.write(true)
+}
+
+// saveSplit records the progress of a split of the table.
+func (c *checkpointer) saveSplit(table string, i int, o splitOutcome) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i < len(c.state.Splits[table]) {
+		c.state.Splits[table][i] = o
+	}
+	return c.write(false)
+}
+
+// complete records the result of a completed table.
+func (c *checkpointer) complete(table string, result *TableResult) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Tables[table] = result
+	delete(c.state.Splits, table)
+	return c.write(true)
+}
+
+// remove deletes the state file once the comparison is completed.
+func (c *checkpointer) remove() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := os.Remove(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// write writes the state file unless it was written recently, the caller
+// must hold the lock. The file is replaced atomically so that an interrupted
+// write doesn't corrupt the previous checkpoint.
+func (c *checkpointer) write(force bool) error {
+	if !force && time.Since(c.saved) < checkpointInterval {
+		return nil
+	}
+
+	b, err := json.Marshal(c.state)
+	if err != nil {
+		return fmt.Errorf("could not encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+
+	c.saved = time.Now()
+	return nil
+}
+
+// fingerprint identifies a comparison by its databases and options. The
+// server versions and the options that don't affect the results, like the
+// parallelism and the retries, are left out.
+func fingerprint(src, dst DatabaseInfo, opts CompareOptions) (string, error) {
+	src.Version, dst.Version = "", ""
+	opts.Parallelism = 0
+	opts.StatementTimeout, opts.Retries, opts.RetryBackoff = 0, 0, 0
+	opts.KeepGoing = false
+
+	b, err := json.Marshal(struct {
+		Source  DatabaseInfo
+		Target  DatabaseInfo
+		Options CompareOptions
+	}{src, dst, opts})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// MarshalJSON writes the key values of the split along with their types, the
+// keys the pages are resumed from must be read back exactly. The mismatching
+// ranges are only reported, they are written as they are.
+func (o splitOutcome) MarshalJSON() ([]byte, error) {
+	type outcome splitOutcome
+	return json.Marshal(struct {
+		outcome
+		Range  typedRange  `json:"range"`
+		Cursor typedValues `json:"cursor,omitempty"`
+	}{outcome(o), typedRange{From: o.Range.From, To: o.Range.To}, o.Cursor})
+}
+
+// UnmarshalJSON reads a split written by MarshalJSON.
+func (o *splitOutcome) UnmarshalJSON(b []byte) error {
+	type outcome splitOutcome
+	s := struct {
+		*outcome
+		Range  typedRange  `json:"range"`
+		Cursor typedValues `json:"cursor,omitempty"`
+	}{outcome: (*outcome)(o)}
+
+	// the numbers of the reported ranges are kept as they are
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&s); err != nil {
+		return err
+	}
+
+	o.Range = KeyRange{From: s.Range.From, To: s.Range.To}
+	o.Cursor = s.Cursor
+	return nil
+}
+
+// typedRange is a KeyRange with typed key values.
+type typedRange struct {
+	From typedValues
+	To   typedValues
+}
+
+// typedValue is a key value along with its type. The strings and the bytes
+// are base64 encoded, the keys of the binary columns are not valid UTF-8.
+type typedValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// typedValues are the key values written with their types, so that they are
+// read back as the same values.
+type typedValues []any
+
+// MarshalJSON writes each value along with its type.
+func (v typedValues) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+
+	values := make([]typedValue, len(v))
+	for i, value := range v {
+		switch t := value.(type) {
+		case nil:
+			values[i] = typedValue{Type: "null"}
+		case string:
+			values[i] = typedValue{Type: "string", Value: base64.StdEncoding.EncodeToString([]byte(t))}
+		case []byte:
+			values[i] = typedValue{Type: "bytes", Value: base64.StdEncoding.EncodeToString(t)}
+		case int64:
+			values[i] = typedValue{Type: "int", Value: strconv.FormatInt(t, 10)}
+		case int:
+			values[i] = typedValue{Type: "int", Value: strconv.Itoa(t)}
+		case uint64:
+			values[i] = typedValue{Type: "uint", Value: strconv.FormatUint(t, 10)}
+		case float64:
+			values[i] = typedValue{Type: "float", Value: strconv.FormatFloat(t, 'g', -1, 64)}
+		case bool:
+			values[i] = typedValue{Type: "bool", Value: strconv.FormatBool(t)}
+		case time.Time:
+			values[i] = typedValue{Type: "time", Value: t.Format(time.RFC3339Nano)}
+		default:
+			return nil, fmt.Errorf("unsupported key value type %T", value)
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON reads the values written by MarshalJSON.
+func (v *typedValues) UnmarshalJSON(b []byte) error {
+	var values []typedValue
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	if values == nil {
+		*v = nil
+		return nil
+	}
+
+	*v = make(typedValues, len(values))
+	for i, value := range values {
+		var err error
+		switch value.Type {
+		case "null":
+			(*v)[i] = nil
+		case "string":
+			var b []byte
+			b, err = base64.StdEncoding.DecodeString(value.Value)
+			(*v)[i] = string(b)
+		case "bytes":
+			(*v)[i], err = base64.StdEncoding.DecodeString(value.Value)
+		case "int":
+			(*v)[i], err = strconv.ParseInt(value.Value, 10, 64)
+		case "uint":
+			(*v)[i], err = strconv.ParseUint(value.Value, 10, 64)
+		case "float":
+			(*v)[i], err = strconv.ParseFloat(value.Value, 64)
+		case "bool":
+			(*v)[i], err = strconv.ParseBool(value.Value)
+		case "time":
+			(*v)[i], err = time.Parse(time.RFC3339Nano, value.Value)
+		default:
+			err = fmt.Errorf("unsupported key value type %q", value.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read key value: %w", err)
+		}
+	}
+
+	return nil
+}
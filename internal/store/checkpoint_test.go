@@ -0,0 +1,84 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	cp, err := openCheckpoint(path, "fp", false)
+	require.NoError(t, err)
+
+	err = cp.startSplits("posts", []splitOutcome{
+		{Range: KeyRange{To: []any{int64(9007199254740993)}}},
+		{Range: KeyRange{From: []any{int64(9007199254740993)}}},
+	})
+	require.NoError(t, err)
+
+	err = cp.complete("users", &TableResult{TableName: "Users", Status: TableStatusMatch, PagesChecked: 3})
+	require.NoError(t, err)
+
+	// the progress of the pages is written at most once per interval
+	err = cp.saveSplit("posts", 0, splitOutcome{
+		Range:  KeyRange{To: []any{int64(9007199254740993)}},
+		Cursor: []any{int64(42)},
+		Pages:  1,
+	})
+	require.NoError(t, err)
+
+	_, err = openCheckpoint(path, "other", true)
+	require.Error(t, err)
+
+	resumed, err := openCheckpoint(path, "fp", true)
+	require.NoError(t, err)
+	require.Equal(t, TableStatusMatch, resumed.result("users").Status)
+	require.Equal(t, 3, resumed.result("users").PagesChecked)
+	require.Nil(t, resumed.result("posts"))
+
+	outcomes := resumed.splits("posts")
+	require.Len(t, outcomes, 2)
+	require.Equal(t, []any{int64(9007199254740993)}, outcomes[0].Range.To)
+	require.Nil(t, outcomes[0].Cursor)
+	require.Equal(t, []any{int64(9007199254740993)}, outcomes[1].Range.From)
+
+	err = cp.remove()
+	require.NoError(t, err)
+	_, err = openCheckpoint(path, "fp", true)
+	require.Error(t, err)
+
+	var nilCheckpoint *checkpointer
+	require.Nil(t, nilCheckpoint.result("users"))
+	require.NoError(t, nilCheckpoint.complete("users", &TableResult{}))
+}
+
+func TestCheckpointBinaryKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	cp, err := openCheckpoint(path, "fp", false)
+	require.NoError(t, err)
+
+	// the keys of the binary columns are normalized to strings that are not
+	// valid UTF-8
+	key := []any{"\xff\x00\xfea", []byte{0x80, 0x81}, int64(-7), uint64(18446744073709551615), nil}
+	err = cp.startSplits("files", []splitOutcome{
+		{Range: KeyRange{To: key}, Cursor: key, Pages: 2},
+		{Range: KeyRange{From: key}},
+	})
+	require.NoError(t, err)
+
+	resumed, err := openCheckpoint(path, "fp", true)
+	require.NoError(t, err)
+
+	outcomes := resumed.splits("files")
+	require.Len(t, outcomes, 2)
+	require.Equal(t, key, outcomes[0].Cursor)
+	require.Equal(t, key, outcomes[0].Range.To)
+	require.Nil(t, outcomes[0].Range.From)
+	require.Equal(t, 2, outcomes[0].Pages)
+	require.Equal(t, key, outcomes[1].Range.From)
+	require.Nil(t, outcomes[1].Cursor)
+}
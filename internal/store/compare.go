@@ -1,112 +1,835 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type CompareOptions struct {
-	ExcludePatterns []string
-	Verbose         bool
-	PageSize        int
+	ExcludePatterns []string `json:"exclude_patterns"`
+	Verbose         bool     `json:"verbose"`
+	PageSize        int      `json:"page_size"`
+	// MinRangeSize enables the bisection of the mismatching pages. Such pages
+	// are split into halves recursively until the differing key ranges
+	// contain no more than MinRangeSize source rows. When it's zero, the
+	// comparison of a table stops at the first mismatching page.
+	MinRangeSize int `json:"min_range_size"`
+	// CommonColumns compares only the columns that exist on both sides
+	// instead of reporting a schema mismatch when the column sets differ.
+	CommonColumns bool `json:"common_columns"`
+	// AllowMissingTables doesn't fail the comparison for the tables that
+	// exist in the source only, they are still reported.
+	AllowMissingTables bool `json:"allow_missing_tables"`
+	// FailOnExtraTables fails the comparison for the tables that exist in
+	// the target only, otherwise they are only reported.
+	FailOnExtraTables bool `json:"fail_on_extra_tables"`
+	// BinaryKeyOrder compares the string keys byte-wise instead of paging
+	// the tables in the order of the key collations, for the databases of
+	// the same dialect with different collations. The keys of the databases
+	// of different dialects are always compared byte-wise. The primary key
+	// indexes can't be used then, each page is sorted by the databases.
+	BinaryKeyOrder bool `json:"binary_key_order"`
+	// Partitioning is the way the tables are split up, the tables are paged
+	// by default. MinRangeSize applies to the pages only.
+	Partitioning Partitioning `json:"partitioning,omitempty"`
+	// Buckets is the number of buckets the rows are grouped into when the
+	// tables are partitioned into buckets.
+	Buckets int `json:"buckets,omitempty"`
+	// OrderingKeys overrides the keys the tables are paged by, the keys are
+	// the table names. The columns must be non-null and contain every column
+	// of a unique index, such as the primary key, on both sides.
+	OrderingKeys map[string][]string `json:"ordering_keys,omitempty"`
+	// Parallelism is the number of tables compared concurrently, along with
+	// Splits it limits the number of connections opened to each database.
+	Parallelism int `json:"parallelism,omitempty"`
+	// Splits is the number of key ranges the large tables are split into.
+	// The ranges of a table are compared concurrently.
+	Splits int `json:"splits,omitempty"`
+	// Shard limits the comparison to a deterministic subset of the tables so
+	// that a comparison can be spread over several processes.
+	Shard *Shard `json:"shard,omitempty"`
+	// ShardKeyRanges shards the splits of the tables instead of the tables.
+	// Each shard counts the rows of every table but walks its own splits
+	// only.
+	ShardKeyRanges bool `json:"shard_key_ranges,omitempty"`
+	// StateFile is the file the progress of the comparison is written into,
+	// it's removed once the comparison completes.
+	StateFile string `json:"-"`
+	// StatementTimeout limits the execution time of each query, it's set as
+	// the max_execution_time of mysql and the statement_timeout of postgres.
+	StatementTimeout time.Duration `json:"statement_timeout,omitempty"`
+	// Retries is the number of times a query failing with a transient error,
+	// such as a deadlock or a dropped connection, is retried.
+	Retries int `json:"retries,omitempty"`
+	// RetryBackoff is the delay before the first retry of a query, it
+	// doubles after each retry.
+	RetryBackoff time.Duration `json:"retry_backoff,omitempty"`
+	// Snapshot reads the tables from consistent snapshots, either one per
+	// table or one for the whole run on each side. The tables can't be split
+	// then, and a single snapshot allows no parallelism.
+	Snapshot SnapshotScope `json:"snapshot,omitempty"`
+	// Reverify is the number of times a mismatching page, or row count, is
+	// checked again before it's reported as different. It's meant for live
+	// databases whose writes cause transient mismatches.
+	Reverify int `json:"reverify,omitempty"`
+	// ReverifyDelay is the delay before each re-check of a mismatch.
+	ReverifyDelay time.Duration `json:"reverify_delay,omitempty"`
+	// KeepGoing compares the remaining tables after a table fails, the
+	// failed tables are reported with their errors instead.
+	KeepGoing bool `json:"keep_going,omitempty"`
+	// Resume continues the comparison from the progress in the StateFile.
+	// The databases and the options must be the same.
+	Resume bool `json:"-"`
+	// OnTableComplete is called with the result of each table as soon as
+	// its comparison completes. The calls are never concurrent.
+	OnTableComplete func(*TableResult) `json:"-"`
 }
 
-func Compare(srcDSN, dstDSN string, opts CompareOptions) ([]string, error) {
-	srcdb, err := NewDB(srcDSN)
+// Compare compares the tables of the databases. If the context is cancelled,
+// the running queries are stopped and the tables completed so far are
+// returned as an incomplete result along with the error of the context.
+func Compare(ctx context.Context, srcDSN, dstDSN string, opts CompareOptions) (*CompareResult, error) {
+	switch opts.Partitioning {
+	case "", PartitioningPages:
+	case PartitioningBuckets:
+		if opts.Buckets < 1 {
+			return nil, fmt.Errorf("bucket count could not be less than 1 (one), current value is: %d", opts.Buckets)
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized partitioning: %s", opts.Partitioning)
+	}
+
+	if opts.Shard != nil {
+		if err := opts.Shard.validate(); err != nil {
+			return nil, err
+		}
+	} else if opts.ShardKeyRanges {
+		return nil, errors.New("the key ranges could not be sharded without a shard")
+	}
+
+	switch opts.Snapshot {
+	case SnapshotNone:
+	case SnapshotTable, SnapshotRun:
+		if opts.Splits > 1 {
+			return nil, errors.New("the splits of a table could not be read from a single snapshot")
+		}
+		if opts.Snapshot == SnapshotRun && opts.Parallelism > 1 {
+			return nil, errors.New("the tables could not be compared in parallel from a single snapshot")
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized snapshot scope: %s", opts.Snapshot)
+	}
+
+	if opts.Reverify < 0 {
+		return nil, fmt.Errorf("reverify could not be less than 0 (zero), current value is: %d", opts.Reverify)
+	} else if opts.Reverify > 0 && opts.Snapshot != SnapshotNone {
+		return nil, errors.New("the mismatches could not be re-checked within a snapshot, it never changes")
+	}
+
+	if opts.Resume && opts.StateFile == "" {
+		return nil, errors.New("a comparison could not be resumed without a state file")
+	}
+
+	start := time.Now()
+	result := &CompareResult{
+		allowMissingTables: opts.AllowMissingTables,
+		failOnExtraTables:  opts.FailOnExtraTables,
+	}
+
+	srcdb, dstdb, err := openDatabases(srcDSN, dstDSN, opts)
 	if err != nil {
-		return nil, fmt.Errorf("could not initiate src db connection: %w", err)
+		return nil, err
 	}
 	defer srcdb.sqlDB.Close()
+	defer dstdb.sqlDB.Close()
 
-	srcTables, err := srcdb.TableList()
+	stop := killQueriesOnDone(ctx, srcdb, dstdb)
+	defer stop()
+
+	srcTables, dstTables, excl, err := listTables(srcdb, dstdb, opts.ExcludePatterns)
 	if err != nil {
-		return nil, fmt.Errorf("could not list src tables: %w", err)
+		return nil, err
 	}
+	result.Excluded = excl
 
-	dstdb, err := NewDB(dstDSN)
-	if err != nil {
-		return nil, fmt.Errorf("could not initiate dst db connection: %w", err)
+	for k := range opts.OrderingKeys {
+		if _, ok := srcTables[strings.ToLower(k)]; !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("ordering key of %q is ignored, the table is not compared", k))
+		}
 	}
-	defer dstdb.sqlDB.Close()
+	sort.Strings(result.Warnings)
 
-	dstTables, err := dstdb.TableList()
+	// the server versions are only informative
+	result.Source, err = srcdb.Info()
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("source: %s", err))
+	}
+	result.Target, err = dstdb.Info()
 	if err != nil {
-		return nil, fmt.Errorf("could not list dst tables: %w", err)
+		result.Warnings = append(result.Warnings, fmt.Sprintf("target: %s", err))
 	}
 
-	excl := sliceToMap(opts.ExcludePatterns)
+	var cp *checkpointer
+	if opts.StateFile != "" {
+		fp, err := fingerprint(result.Source, result.Target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not fingerprint the comparison: %w", err)
+		}
 
-	// find a more elegant solution fo this
-	// essentially we want to exclude some
-	// patterns from comparing.
-	for k := range srcTables {
-		for e := range excl {
-			if strings.Contains(k, strings.ToLower(e)) {
-				delete(srcTables, k)
+		cp, err = openCheckpoint(opts.StateFile, fp, opts.Resume)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the data of all tables is read from a single snapshot on each side,
+	// the metadata is still read through the connection pools.
+	if opts.Snapshot == SnapshotRun {
+		srcdb, dstdb, result.SourceSnapshot, result.TargetSnapshot, err = snapshots(ctx, srcdb, dstdb)
+		if err != nil {
+			return nil, err
+		}
+		defer srcdb.release()
+		defer dstdb.release()
+	}
+
+	// the tables existing on one side only are reported along with the
+	// compared ones, the tables are sorted by name.
+	names := sortedTableNames(srcTables)
+	for k := range dstTables {
+		if _, ok := srcTables[k]; !ok && !excluded(k, opts.ExcludePatterns) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	// a shard compares its own tables only, unless the tables are sharded
+	// by their key ranges.
+	if opts.Shard != nil && !opts.ShardKeyRanges {
+		owned := names[:0]
+		for _, k := range names {
+			if opts.Shard.owns(k, 0) {
+				owned = append(owned, k)
 			}
 		}
+		names = owned
 	}
 
-	var mismatchs []string
+	// the tables are compared by a pool of workers, yet the results are kept
+	// in the order of the tables to produce a deterministic result. In case
+	// of an error no more tables are started, the results gathered so far are
+	// returned along with the error of the first failing table, unless we are
+	// asked to keep going. Once the context is cancelled, the interrupted
+	// tables are left out.
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
 
-tableLoop:
-	for k, v := range srcTables {
-		v2, ok := dstTables[strings.ToLower(k)]
-		if !ok {
-			return nil, fmt.Errorf("%q table is not found in dst schema", k)
+	results := make([]*TableResult, len(names))
+	errs := make([]error, len(names))
+	var failed atomic.Bool
+	var completeMu sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan int)
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				k := names[i]
+				var err error
+				tr := cp.result(k)
+				resumed := tr != nil
+				v, ok1 := srcTables[k]
+				v2, ok2 := dstTables[k]
+				switch {
+				case resumed:
+					// completed before the comparison was interrupted
+				case !ok2:
+					tr, err = missingTable(ctx, srcdb, v, TableStatusMissingInTarget)
+				case !ok1:
+					tr, err = missingTable(ctx, dstdb, v2, TableStatusExtraInTarget)
+				default:
+					tr, err = compareTable(ctx, srcdb, dstdb, v, v2, opts, cp)
+				}
+				if tr != nil && !resumed {
+					tr.Retries = srcdb.retriesOf(k) + dstdb.retriesOf(k)
+					if opts.Snapshot == SnapshotRun {
+						tr.SourceSnapshot, tr.TargetSnapshot = result.SourceSnapshot, result.TargetSnapshot
+					}
+				}
+				if err == nil && !resumed {
+					err = cp.complete(k, tr)
+				}
+				if err != nil && ctx.Err() != nil {
+					continue
+				}
+				results[i], errs[i] = tr, err
+				if err != nil && !opts.KeepGoing {
+					failed.Store(true)
+				}
+
+				completeMu.Lock()
+				opts.tableComplete(tr)
+				completeMu.Unlock()
+			}
+		}()
+	}
+
+	for i := range names {
+		if failed.Load() || ctx.Err() != nil {
+			break
 		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-		// we do a count comparison to save some resources before diving deeper
-		c1, err := srcdb.count(v)
-		if err != nil {
-			return nil, fmt.Errorf("could not count rows of %q: %w", v.TableName, err)
+	for i := range names {
+		if results[i] != nil {
+			result.Tables = append(result.Tables, results[i])
+		}
+	}
+
+	result.Elapsed = time.Since(start)
+	if err := ctx.Err(); err != nil {
+		result.Incomplete = true
+		return result, fmt.Errorf("comparison is incomplete: %w", err)
+	}
+
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !opts.KeepGoing {
+			return result, err
 		}
-		c2, err := dstdb.count(v2)
+
+		// the failed tables are compared again once resumed
+		return result, nil
+	}
+
+	// the state file is only needed to resume an incomplete comparison
+	if err := cp.remove(); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("could not remove state file: %s", err))
+	}
+
+	return result, nil
+}
+
+// killQueriesOnDone kills the running queries of the databases once the
+// context is done. The returned function stops watching the context, it must
+// be called before the databases are closed.
+func killQueriesOnDone(ctx context.Context, dbs ...*DB) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		// the queries are killed on a best effort basis, the comparison
+		// fails anyway
+		for _, db := range dbs {
+			_ = db.killQueries()
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// ownsSplit returns true if the split of the table is compared by this
+// process. If the tables are not sharded by their key ranges, the tables are
+// already left out by Compare.
+func (opts CompareOptions) ownsSplit(tableName string, split int) bool {
+	if !opts.ShardKeyRanges {
+		return true
+	}
+
+	return opts.Shard.owns(tableName, split)
+}
+
+func (opts CompareOptions) tableComplete(result *TableResult) {
+	if opts.OnTableComplete != nil {
+		opts.OnTableComplete(result)
+	}
+}
+
+// orderingKey returns the ordering key override of the table, if any. The
+// table names are matched case-insensitively.
+func (opts CompareOptions) orderingKey(tableName string) []string {
+	for k, v := range opts.OrderingKeys {
+		if strings.EqualFold(k, tableName) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// missingTable reports a table existing on one side only along with its
+// row count.
+func missingTable(ctx context.Context, db *DB, table *TableInfo, status TableStatus) (*TableResult, error) {
+	start := time.Now()
+	result := &TableResult{
+		TableName: table.TableName,
+		Status:    status,
+	}
+
+	c, err := db.count(ctx, table)
+	if err != nil {
+		err = fmt.Errorf("could not count rows of %q: %w", table.TableName, err)
+		result.Status = TableStatusError
+		result.Error = err
+		result.Elapsed = time.Since(start)
+		return result, err
+	}
+
+	if status == TableStatusMissingInTarget {
+		result.SourceRows = c
+	} else {
+		result.TargetRows = c
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// compareTable compares a single table. The returned result is never nil, if
+// an error occurs it's marked as failed.
+func compareTable(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, opts CompareOptions, cp *checkpointer) (*TableResult, error) {
+	start := time.Now()
+	result := &TableResult{
+		TableName: src.TableName,
+		Status:    TableStatusMatch,
+	}
+
+	fail := func(err error) (*TableResult, error) {
+		result.Status = TableStatusError
+		result.Error = err
+		result.Elapsed = time.Since(start)
+		return result, err
+	}
+
+	// hashing the tables with different columns would just report them as
+	// different, so we make sure the schemas are comparable first.
+	srcCols, dstCols, schemaDiffs := preflight(src, dst, opts.CommonColumns)
+	for _, d := range schemaDiffs {
+		result.Warnings = append(result.Warnings, d.String())
+	}
+
+	// all reads of the table are made from a single snapshot on each side
+	if opts.Snapshot == SnapshotTable {
+		var err error
+		srcdb, dstdb, result.SourceSnapshot, result.TargetSnapshot, err = snapshots(ctx, srcdb, dstdb)
 		if err != nil {
-			return nil, fmt.Errorf("could not count rows of %q: %w", v2.TableName, err)
+			return fail(fmt.Errorf("could not read %q from a snapshot: %w", src.TableName, err))
 		}
-		if c1 != c2 {
-			mismatchs = append(mismatchs, v.TableName)
-			continue
-		} else if c1 == 0 {
-			continue
+		defer srcdb.release()
+		defer dstdb.release()
+	}
+
+	// we do a count comparison to save some resources before diving deeper
+	c1, err := srcdb.count(ctx, src)
+	if err != nil {
+		return fail(fmt.Errorf("could not count rows of %q: %w", src.TableName, err))
+	}
+	c2, err := dstdb.count(ctx, dst)
+	if err != nil {
+		return fail(fmt.Errorf("could not count rows of %q: %w", dst.TableName, err))
+	}
+
+	// the counts of a live database might differ for a moment only
+	if c1 != c2 && srcCols != nil && opts.Reverify > 0 {
+		retries, converged, err := reverify(ctx, opts, func() (bool, error) {
+			err := concurrently(func() error {
+				var err error
+				c1, err = srcdb.count(ctx, src)
+				return err
+			}, func() error {
+				var err error
+				c2, err = dstdb.count(ctx, dst)
+				return err
+			})
+			return c1 == c2, err
+		})
+		if err != nil {
+			return fail(fmt.Errorf("could not count rows of %q again: %w", src.TableName, err))
 		}
+		result.Reverification = result.Reverification.add(retries, converged, nil)
+	}
+	result.SourceRows = c1
+	result.TargetRows = c2
 
-		remaining := opts.PageSize
-		var cd1, cd2 cursorData
-		var srcCheksum, dstChecksum string
+	if srcCols == nil {
+		result.Status = TableStatusSchemaMismatch
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
 
-		// loop until no remaining rows left to calculate checksum
-		for remaining > 0 {
-			if cd1.cursors == nil {
-				cd1.limit = remaining
-			}
-			if cd2.cursors == nil {
-				cd2.limit = remaining
+	src, dst, warning, err := keyedTables(srcdb, dstdb, srcCols, dstCols, opts.orderingKey(src.TableName))
+	if err != nil {
+		return fail(fmt.Errorf("could not determine the keys of %q: %w", result.TableName, err))
+	}
+	if warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	if c1 != c2 {
+		result.Status = TableStatusCountMismatch
+	}
+
+	// the pages are still walked if we are asked to localize the differences
+	if (c1 != c2 && opts.MinRangeSize == 0) || (c1 == 0 && c2 == 0) {
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	// the large tables are split into ranges of keys which are walked
+	// concurrently, small tables are not worth the boundary queries.
+	splittable := opts.Partitioning != PartitioningBuckets && len(src.PrimaryKeys) > 0 &&
+		opts.Splits > 1 && c1 >= opts.Splits*opts.PageSize
+
+	// the tables that are not split are compared by a single shard
+	if !splittable && !opts.ownsSplit(src.TableName, 0) {
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	if opts.Partitioning == PartitioningBuckets {
+		mismatched, err := compareBuckets(ctx, srcdb, dstdb, src, dst, opts.Buckets)
+		if err != nil {
+			return fail(fmt.Errorf("could not compare %q: %w", src.TableName, err))
+		}
+
+		// a bucket is different only if it stays different
+		if len(mismatched) > 0 && opts.Reverify > 0 {
+			retries, converged, err := reverify(ctx, opts, func() (bool, error) {
+				again, err := compareBuckets(ctx, srcdb, dstdb, src, dst, opts.Buckets)
+				if err != nil {
+					return false, err
+				}
+				mismatched = intersectBuckets(mismatched, again)
+				return len(mismatched) == 0, nil
+			})
+			if err != nil {
+				return fail(fmt.Errorf("could not compare %q again: %w", src.TableName, err))
 			}
-			srcCheksum, cd1, err = srcdb.checksum(v, cd1)
+			result.Reverification = result.Reverification.add(retries, converged, nil)
+		}
+
+		result.PagesChecked = opts.Buckets
+		result.MismatchedBuckets = mismatched
+		if len(mismatched) > 0 && result.Status == TableStatusMatch {
+			result.Status = TableStatusChecksumMismatch
+		}
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	// the tables without keys can't be paged, they are checksummed as a whole
+	if len(src.PrimaryKeys) == 0 {
+		equal, err := checksumsEqual(ctx, srcdb, dstdb, src, dst, cursorData{})
+		if err != nil {
+			return fail(fmt.Errorf("could not compare %q: %w", src.TableName, err))
+		}
+
+		if !equal && opts.Reverify > 0 {
+			retries, converged, err := reverify(ctx, opts, func() (bool, error) {
+				return checksumsEqual(ctx, srcdb, dstdb, src, dst, cursorData{})
+			})
 			if err != nil {
-				return nil, fmt.Errorf("could not compute src checksum: %w", err)
+				return fail(fmt.Errorf("could not compare %q again: %w", src.TableName, err))
 			}
+			result.Reverification = result.Reverification.add(retries, converged, nil)
+			equal = converged
+		}
 
-			dstChecksum, cd2, err = dstdb.checksum(v2, cd2)
+		result.PagesChecked = 1
+		if !equal && result.Status == TableStatusMatch {
+			result.Status = TableStatusChecksumMismatch
+		}
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	// an interrupted comparison continues with the splits it was walking
+	key := strings.ToLower(src.TableName)
+	outcomes := cp.splits(key)
+	if outcomes == nil {
+		splits := []KeyRange{{}}
+		if splittable {
+			splits, err = srcdb.splitRanges(ctx, src, c1, opts.Splits)
 			if err != nil {
-				return nil, fmt.Errorf("could not compute dst checksum: %w", err)
+				return fail(fmt.Errorf("could not split %q: %w", src.TableName, err))
 			}
+		}
 
-			if srcCheksum != dstChecksum {
-				mismatchs = append(mismatchs, v.TableName)
-				continue tableLoop
+		outcomes = make([]splitOutcome, len(splits))
+		for i := range splits {
+			outcomes[i].Range = splits[i]
+		}
+
+		err = cp.startSplits(key, outcomes)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	walks := make([]func() error, len(outcomes))
+	for i := range outcomes {
+		i := i
+		walks[i] = func() error {
+			if !opts.ownsSplit(src.TableName, i) {
+				return nil
 			}
+			return outcomes[i].walk(ctx, srcdb, dstdb, src, dst, opts, func(o splitOutcome) error {
+				return cp.saveSplit(key, i, o)
+			})
+		}
+	}
+
+	err = concurrently(walks...)
+	if err != nil {
+		return fail(fmt.Errorf("could not compare %q: %w", src.TableName, err))
+	}
+
+	// the outcomes are merged in the order of the keys
+	for _, o := range outcomes {
+		result.PagesChecked += o.Pages
+		result.Reverification = result.Reverification.merge(o.Reverification)
+		if o.FirstMismatch == nil {
+			continue
+		}
+
+		if result.Status == TableStatusMatch {
+			result.Status = TableStatusChecksumMismatch
+		}
+		if result.FirstMismatch == nil {
+			result.FirstMismatch = o.FirstMismatch
+		}
+		result.MismatchedRanges = append(result.MismatchedRanges, o.MismatchedRanges...)
+		if len(outcomes) > 1 {
+			result.MismatchedSplits = append(result.MismatchedSplits, o.Range)
+		}
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// preflight checks whether the tables have the same column sets and primary
+// keys. If commonColumns is set, the tables are narrowed down to the columns
+// they share instead. The returned tables are nil if they are not comparable.
+func preflight(src, dst *TableInfo, commonColumns bool) (*TableInfo, *TableInfo, []SchemaDifference) {
+	var diffs []SchemaDifference
+	for _, d := range compareColumns(src, dst) {
+		if d.Kind == SchemaDiffColumnMissing || d.Kind == SchemaDiffColumnExtra {
+			diffs = append(diffs, d)
+		}
+	}
+	pkDiffs := comparePrimaryKeys(src, dst)
+
+	if len(pkDiffs) > 0 || (len(diffs) > 0 && !commonColumns) {
+		return nil, nil, append(diffs, pkDiffs...)
+	} else if len(diffs) == 0 {
+		return src, dst, nil
+	}
+
+	srcColumns := make(map[string]struct{}, len(src.Columns))
+	for _, c := range src.Columns {
+		srcColumns[strings.ToLower(c.ColumnName)] = struct{}{}
+	}
+
+	narrowed := func(t *TableInfo, other map[string]struct{}) *TableInfo {
+		n := *t
+		n.Columns = nil
+		for _, c := range t.Columns {
+			if _, ok := other[strings.ToLower(c.ColumnName)]; ok {
+				n.Columns = append(n.Columns, c)
+			}
+		}
+		return &n
+	}
+
+	dst = narrowed(dst, srcColumns)
+	dstColumns := make(map[string]struct{}, len(dst.Columns))
+	for _, c := range dst.Columns {
+		dstColumns[strings.ToLower(c.ColumnName)] = struct{}{}
+	}
+
+	src = narrowed(src, dstColumns)
+	if len(src.Columns) == 0 {
+		return nil, nil, diffs
+	}
 
-			if cd1.limit != cd2.limit {
-				return nil, fmt.Errorf("could not compute checksum: cursors are out of sync")
+	return src, dst, diffs
+}
+
+// walkPages iterates over the source table page by page within the given
+// bounds, the table is walked as a whole if they are nil. Each source page
+// defines a key range and the same range is checksummed on the target, so that
+// the missing or extra rows don't shift the pages of the target out of sync.
+// The last page of the source extends to the upper bound so that the extra
+// rows at the end of the target are taken into account as well. The walk stops
+// when fn returns false or an error.
+func walkPages(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, bounds KeyRange, pageSize int, fn func(page cursorData, equal bool) (bool, error)) error {
+	cursor := cursorData{cursors: bounds.From, upper: bounds.To, limit: pageSize}
+	srcChecksum, next, err := srcdb.checksum(ctx, src, cursor)
+	if err != nil {
+		return fmt.Errorf("could not compute src checksum: %w", err)
+	}
+
+	for {
+		page := cursorData{
+			cursors: cursor.cursors,
+			upper:   next.cursors,
+		}
+		if next.cursors == nil {
+			page.upper = bounds.To
+		}
+		next.upper = bounds.To
+
+		// the target checksum of this page doesn't depend on the source
+		// checksum of the next one, so they are computed concurrently.
+		var dstChecksum, nextChecksum string
+		var following cursorData
+		err := concurrently(func() error {
+			var err error
+			dstChecksum, _, err = dstdb.checksum(ctx, dst, page)
+			if err != nil {
+				return fmt.Errorf("could not compute dst checksum: %w", err)
+			}
+			return nil
+		}, func() error {
+			if next.cursors == nil {
+				return nil
+			}
+			var err error
+			nextChecksum, following, err = srcdb.checksum(ctx, src, next)
+			if err != nil {
+				return fmt.Errorf("could not compute src checksum: %w", err)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-			remaining = cd1.limit
+		ok, err := fn(page, srcChecksum == dstChecksum)
+		if err != nil {
+			return err
+		} else if !ok || next.cursors == nil {
+			return nil
 		}
 
+		cursor, srcChecksum, next = next, nextChecksum, following
+	}
+}
+
+// openDatabases initiates the source and the target database connections.
+func openDatabases(srcDSN, dstDSN string, opts CompareOptions) (*DB, *DB, error) {
+	srcDSN, err := withStatementTimeout(srcDSN, opts.StatementTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set src statement timeout: %w", err)
+	}
+
+	dstDSN, err = withStatementTimeout(dstDSN, opts.StatementTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set dst statement timeout: %w", err)
+	}
+
+	srcdb, err := NewDB(srcDSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not initiate src db connection: %w", err)
+	}
+
+	dstdb, err := NewDB(dstDSN)
+	if err != nil {
+		srcdb.sqlDB.Close()
+		return nil, nil, fmt.Errorf("could not initiate dst db connection: %w", err)
+	}
+	srcdb.binaryKeyOrder = binaryKeyOrder(srcdb.dbType, dstdb.dbType, opts)
+	dstdb.binaryKeyOrder = srcdb.binaryKeyOrder
+	srcdb.retries = retryPolicy{retries: opts.Retries, backoff: opts.RetryBackoff}
+	dstdb.retries = srcdb.retries
+
+	// each split of a table being compared uses a single connection per side
+	// at a time. A snapshot holds its connection while the metadata is read
+	// through another one.
+	if opts.Parallelism > 0 {
+		conns := opts.Parallelism
+		if opts.Splits > 1 {
+			conns *= opts.Splits
+		}
+		if opts.Snapshot != SnapshotNone {
+			conns *= 2
+		}
+		for _, db := range []*DB{srcdb, dstdb} {
+			db.sqlDB.SetMaxOpenConns(conns)
+			db.sqlDB.SetMaxIdleConns(conns)
+		}
+	}
+
+	return srcdb, dstdb, nil
+}
+
+// binaryKeyOrder returns true if the string keys are to be compared byte-wise.
+// The collations of MySQL and Postgres order the same keys differently, so
+// the pages of both sides wouldn't contain the same rows.
+func binaryKeyOrder(srcType, dstType string, opts CompareOptions) bool {
+	return opts.BinaryKeyOrder || srcType != dstType
+}
+
+// listTables lists the source and the target tables, the source tables
+// matching any of the exclude patterns are left out and returned in order.
+func listTables(srcdb, dstdb *DB, excludePatterns []string) (map[string]*TableInfo, map[string]*TableInfo, []string, error) {
+	srcTables, err := srcdb.TableList()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not list src tables: %w", err)
+	}
+
+	dstTables, err := dstdb.TableList()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not list dst tables: %w", err)
+	}
+
+	var excl []string
+	for k, v := range srcTables {
+		if excluded(k, excludePatterns) {
+			excl = append(excl, v.TableName)
+			delete(srcTables, k)
+		}
+	}
+	sort.Strings(excl)
+
+	return srcTables, dstTables, excl, nil
+}
+
+// excluded returns true if the table name matches any of the exclude patterns.
+func excluded(tableName string, excludePatterns []string) bool {
+	// find a more elegant solution fo this
+	// essentially we want to exclude some
+	// patterns from comparing.
+	for _, e := range excludePatterns {
+		if strings.Contains(strings.ToLower(tableName), strings.ToLower(e)) {
+			return true
+		}
 	}
 
-	return mismatchs, nil
+	return false
 }
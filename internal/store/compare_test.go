@@ -1,33 +1,37 @@
 package store
 
 import (
+	"context"
 	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestCompare(t *testing.T) {
 	// compare empty databases
-	mismatches, err := Compare(mysqlTestDSN, pgsqlTestDSN, CompareOptions{})
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{})
 	require.NoError(t, err)
-	require.Empty(t, mismatches)
+	require.Empty(t, result.Mismatches())
 
 	ec := rand.Intn(100) + 20 // we add 20 to ensure pagination gets triggered
 	h := newTestHelper(t).SeedTableData(ec)
 	defer h.Teardown()
 
-	mismatches, err = Compare(mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
 		PageSize: 20,
 	})
 	require.NoError(t, err)
-	require.Empty(t, mismatches)
+	require.Empty(t, result.Mismatches())
+	require.Len(t, result.Tables, 2)
 
-	mismatches, err = Compare(pgsqlTestDSN, mysqlTestDSN, CompareOptions{
+	result, err = Compare(context.Background(), pgsqlTestDSN, mysqlTestDSN, CompareOptions{
 		PageSize: 20,
 	})
 	require.NoError(t, err)
-	require.Empty(t, mismatches)
+	require.Empty(t, result.Mismatches())
 
 	mysqldb, ok := h.dbInstances["mysql"]
 	require.True(t, ok)
@@ -36,9 +40,396 @@ func TestCompare(t *testing.T) {
 	_, err = mysqldb.sqlDB.Query("DELETE FROM Table1 LIMIT 1")
 	require.NoError(t, err)
 
-	mismatches, err = Compare(pgsqlTestDSN, mysqlTestDSN, CompareOptions{
+	result, err = Compare(context.Background(), pgsqlTestDSN, mysqlTestDSN, CompareOptions{
 		PageSize: 20,
 	})
 	require.NoError(t, err)
-	require.Len(t, mismatches, 1)
+	require.Len(t, result.Mismatches(), 1)
+
+	table1 := result.Mismatches()[0]
+	require.Equal(t, "table1", table1.TableName)
+	require.Equal(t, TableStatusCountMismatch, table1.Status)
+	require.Equal(t, ec, table1.SourceRows)
+	require.Equal(t, ec-1, table1.TargetRows)
+}
+
+func TestCompareBisect(t *testing.T) {
+	ec := rand.Intn(100) + 40
+	h := newTestHelper(t).SeedTableData(ec)
+	defer h.Teardown()
+
+	mysqldb, ok := h.dbInstances["mysql"]
+	require.True(t, ok)
+
+	_, err := mysqldb.sqlDB.Exec("DELETE FROM Table1 LIMIT 1")
+	require.NoError(t, err)
+
+	result, err := Compare(context.Background(), pgsqlTestDSN, mysqlTestDSN, CompareOptions{
+		PageSize:     20,
+		MinRangeSize: 4,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.NotNil(t, result.Mismatches()[0].FirstMismatch)
+	require.Len(t, result.Mismatches()[0].MismatchedRanges, 1)
+}
+
+func TestCompareSchemaPreflight(t *testing.T) {
+	ec := rand.Intn(100) + 20
+	h := newTestHelper(t).SeedTableData(ec)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("ALTER TABLE Table1 ADD COLUMN Extra VARCHAR(10) DEFAULT 'extra'")
+	require.NoError(t, err)
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusSchemaMismatch, result.Mismatches()[0].Status)
+	require.NotEmpty(t, result.Mismatches()[0].Warnings)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:      20,
+		CommonColumns: true,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.NotEmpty(t, result.Tables[0].Warnings)
+}
+
+func TestCompareMissingTables(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(10)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("ALTER TABLE Table2 RENAME TO Table3")
+	require.NoError(t, err)
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Tables, 3)
+	require.Equal(t, TableStatusMatch, result.Tables[0].Status)
+	require.Equal(t, TableStatusMissingInTarget, result.Tables[1].Status)
+	require.Equal(t, TableStatusExtraInTarget, result.Tables[2].Status)
+	require.Equal(t, 10, result.Tables[2].TargetRows)
+	require.Len(t, result.Mismatches(), 1)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:           20,
+		AllowMissingTables: true,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:           20,
+		AllowMissingTables: true,
+		FailOnExtraTables:  true,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusExtraInTarget, result.Mismatches()[0].Status)
+}
+
+func TestCompareMixedCaseKeys(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.Teardown()
+
+	// the case-insensitive and the locale collations order these keys
+	// differently than the byte-wise comparison does.
+	ids := []string{"a", "B", "ab", "a_c", "Ad", "b-e", "be", "C", "_z", "Z"}
+	for name, instance := range h.dbInstances {
+		for _, id := range ids {
+			_, err := instance.sqlDB.NamedExec(`INSERT INTO Table1
+			(Id, CreateAt, Name, Description)
+			VALUES
+			(:Id, :CreateAt, :Name, :Description)
+			`, testStruct1{Id: id, Name: id, Description: id})
+			require.NoError(t, err, "could not insert %q on %q", id, name)
+		}
+	}
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 3,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Equal(t, 4, result.Tables[0].PagesChecked)
+}
+
+func TestCompareBuckets(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(50)
+	defer h.Teardown()
+
+	opts := CompareOptions{
+		Partitioning: PartitioningBuckets,
+		Buckets:      8,
+	}
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Equal(t, 8, result.Tables[0].PagesChecked)
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err = pgdb.sqlDB.Exec("UPDATE Table1 SET Name = 'changed' WHERE Id = (SELECT min(Id) FROM Table1)")
+	require.NoError(t, err)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusChecksumMismatch, result.Mismatches()[0].Status)
+	require.Len(t, result.Mismatches()[0].MismatchedBuckets, 1)
+
+	_, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{Partitioning: PartitioningBuckets})
+	require.Error(t, err)
+}
+
+func TestCompareWithoutPrimaryKey(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.Teardown()
+
+	for name, instance := range h.dbInstances {
+		for _, q := range []string{
+			"CREATE TABLE Table3 (Name varchar(26) NOT NULL, Value integer)",
+			"CREATE UNIQUE INDEX idx_table3_name ON Table3 (Name)",
+			"CREATE TABLE Table4 (Name varchar(26), Value integer)",
+			"INSERT INTO Table3 (Name, Value) VALUES ('a', 1), ('b', 2), ('c', NULL)",
+			"INSERT INTO Table4 (Name, Value) VALUES ('a', 1), ('a', 1), ('b', NULL)",
+		} {
+			_, err := instance.sqlDB.Exec(q)
+			require.NoError(t, err, "could not execute %q on %q", q, name)
+		}
+	}
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 2,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Equal(t, "table3", strings.ToLower(result.Tables[2].TableName))
+	require.Equal(t, 2, result.Tables[2].PagesChecked)
+	require.Contains(t, result.Tables[2].Warnings[0], "idx_table3_name")
+	require.Equal(t, 1, result.Tables[3].PagesChecked)
+	require.Contains(t, result.Tables[3].Warnings[0], "without a key")
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err = pgdb.sqlDB.Exec("DELETE FROM Table4 WHERE Value IS NULL")
+	require.NoError(t, err)
+	_, err = pgdb.sqlDB.Exec("INSERT INTO Table4 (Name, Value) VALUES ('a', 1)")
+	require.NoError(t, err)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusChecksumMismatch, result.Mismatches()[0].Status)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		Partitioning: PartitioningBuckets,
+		Buckets:      4,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+}
+
+func TestCompareParallel(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(60)
+	defer h.Teardown()
+
+	mysqldb, ok := h.dbInstances["mysql"]
+	require.True(t, ok)
+
+	_, err := mysqldb.sqlDB.Exec("DELETE FROM Table2 LIMIT 1")
+	require.NoError(t, err)
+
+	var completed []string
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:    7,
+		Parallelism: 4,
+		OnTableComplete: func(tr *TableResult) {
+			completed = append(completed, tr.TableName)
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, completed, 2)
+	require.Len(t, result.Tables, 2)
+	require.Equal(t, "table1", strings.ToLower(result.Tables[0].TableName))
+	require.Equal(t, TableStatusMatch, result.Tables[0].Status)
+	require.Equal(t, 9, result.Tables[0].PagesChecked)
+	require.Equal(t, TableStatusCountMismatch, result.Tables[1].Status)
+}
+
+func TestCompareSplits(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(100)
+	defer h.Teardown()
+
+	opts := CompareOptions{
+		PageSize: 5,
+		Splits:   4,
+	}
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Empty(t, result.Tables[0].MismatchedSplits)
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err = pgdb.sqlDB.Exec("UPDATE Table1 SET Name = 'changed' WHERE Id = (SELECT max(Id) FROM Table1)")
+	require.NoError(t, err)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusChecksumMismatch, result.Mismatches()[0].Status)
+	require.Len(t, result.Mismatches()[0].MismatchedSplits, 1)
+	require.Nil(t, result.Mismatches()[0].MismatchedSplits[0].To)
+}
+
+func TestCompareCancelled(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := Compare(ctx, mysqlTestDSN, pgsqlTestDSN, CompareOptions{PageSize: 5})
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	require.True(t, result.Incomplete)
+	require.Empty(t, result.Tables)
+	require.False(t, result.Equal())
+}
+
+func TestCompareKeepGoing(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	opts := CompareOptions{
+		PageSize:     5,
+		OrderingKeys: map[string][]string{"Table1": {"Missing"}},
+	}
+
+	_, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.Error(t, err)
+
+	opts.KeepGoing = true
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, opts)
+	require.NoError(t, err)
+	require.Len(t, result.Tables, 2)
+	require.Len(t, result.Errors(), 1)
+	require.Equal(t, TableStatusError, result.Tables[0].Status)
+	require.Error(t, result.Tables[0].Error)
+	require.Equal(t, TableStatusMatch, result.Tables[1].Status)
+	require.False(t, result.Equal())
+}
+
+func TestCompareSnapshot(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 5,
+		Snapshot: SnapshotTable,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Nil(t, result.TargetSnapshot)
+	require.NotNil(t, result.Tables[0].TargetSnapshot)
+	require.NotEmpty(t, result.Tables[0].TargetSnapshot.LSN)
+
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 5,
+		Snapshot: SnapshotRun,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.NotNil(t, result.TargetSnapshot)
+	require.Equal(t, result.TargetSnapshot, result.Tables[0].TargetSnapshot)
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	// the rows written after the snapshot is taken are not counted
+	snapshot, _, err := pgdb.snapshot(context.Background())
+	require.NoError(t, err)
+	tables, err := pgdb.TableList()
+	require.NoError(t, err)
+	_, err = pgdb.sqlDB.Exec("INSERT INTO Table1 (Id, CreateAt, Name, Description) VALUES ($1, 1, 'late', 'late')", newId())
+	require.NoError(t, err)
+
+	c, err := snapshot.count(context.Background(), tables["table1"])
+	require.NoError(t, err)
+	require.Equal(t, 20, c)
+	c, err = snapshot.countRange(context.Background(), tables["table1"], cursorData{})
+	require.NoError(t, err)
+	require.Equal(t, 20, c)
+	snapshot.release()
+
+	_, err = pgdb.sqlDB.Exec("DELETE FROM Table1 WHERE Name = 'late'")
+	require.NoError(t, err)
+
+	// a row written into the target while the run is under way doesn't make
+	// the later tables differ
+	result, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:    5,
+		Snapshot:    SnapshotRun,
+		Parallelism: 1,
+		OnTableComplete: func(tr *TableResult) {
+			if strings.EqualFold(tr.TableName, "Table1") {
+				_, err := pgdb.sqlDB.Exec("INSERT INTO Table2 (Id, AnotherId, IsActive, Props) VALUES ($1, $2, true, '{}')", newId(), newId())
+				require.NoError(t, err)
+			}
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Equal())
+	require.Len(t, result.Tables, 2)
+	require.Equal(t, 20, result.Tables[1].SourceRows)
+	require.Equal(t, 20, result.Tables[1].TargetRows)
+
+	_, err = Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		Snapshot:    SnapshotRun,
+		Parallelism: 2,
+	})
+	require.Error(t, err)
+}
+
+func TestCompareReverify(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("UPDATE Table1 SET Name = 'changed' WHERE Id = (SELECT max(Id) FROM Table1)")
+	require.NoError(t, err)
+
+	result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:      5,
+		Reverify:      2,
+		ReverifyDelay: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches(), 1)
+	require.Equal(t, TableStatusChecksumMismatch, result.Mismatches()[0].Status)
+	require.NotNil(t, result.Mismatches()[0].Reverification)
+	require.Equal(t, "persistent", result.Mismatches()[0].Reverification.String())
+	require.Equal(t, 2, result.Mismatches()[0].Reverification.Retries)
 }
@@ -2,14 +2,20 @@ package store
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -18,14 +24,59 @@ const (
 	DatabaseDriverMysql    = "mysql"
 )
 
+// mysqlErrNoSuchThread is the error of killing a thread that no longer exists.
+const mysqlErrNoSuchThread = 1094
+
 var (
 	ErrEmptyTable = errors.New("the table has no rows to calculate md5")
 )
 
+// QueryError is the error of a query run against one of the databases.
+type QueryError struct {
+	// Dialect is the driver of the database, either mysql or postgres.
+	Dialect string
+	Query   string
+	Err     error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Dialect, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
 // DB is the sql.DB wrapper with some utilities
 type DB struct {
 	sqlDB  *sqlx.DB
 	dbType string
+	info   DatabaseInfo
+	// binaryKeyOrder enables the byte-wise ordering of the string keys.
+	binaryKeyOrder bool
+	// tag identifies the queries of the connection pool on the server, see
+	// tagged.
+	tag string
+	// retries is the retry policy of the queries, the retried queries are
+	// counted per table.
+	retries retryPolicy
+	retried *retryCounts
+	// snapshotConn is the connection holding the transaction of a consistent
+	// snapshot, the data is read through it if it's set. See snapshot.
+	snapshotConn *sqlx.Conn
+
+	// schema caches the current schema of postgres, it doesn't change
+	// during the lifetime of the connection pool.
+	schemaMu sync.Mutex
+	schema   string
+}
+
+// DatabaseInfo describes a database server, it never contains credentials.
+type DatabaseInfo struct {
+	Driver   string `json:"driver"`
+	Host     string `json:"host"`
+	Database string `json:"database"`
+	Version  string `json:"version,omitempty"`
 }
 
 type TableInfo struct {
@@ -36,15 +87,40 @@ type TableInfo struct {
 
 // ColumnInfo is the column info
 type ColumnInfo struct {
-	ColumnName string `db:"column_name"`
-	DataType   string `db:"data_type"`
+	ColumnName string  `db:"column_name"`
+	DataType   string  `db:"data_type"`
+	IsNullable string  `db:"is_nullable"`
+	Default    *string `db:"column_default"`
+}
+
+// Nullable returns true if the column accepts NULL values.
+func (c *ColumnInfo) Nullable() bool {
+	return strings.EqualFold(c.IsNullable, "YES")
+}
+
+// IndexInfo is the index info, columns are in the order of the index.
+type IndexInfo struct {
+	IndexName string
+	Columns   []string
+	Unique    bool
+	Primary   bool
 }
 
+// cursorData defines a page of a table. The cursors are the exclusive lower
+// bound and upper is the inclusive upper bound of the page, a nil value means
+// the page is unbounded in that direction. A zero limit reads the whole range.
 type cursorData struct {
 	cursors []any
+	upper   []any
 	limit   int
 }
 
+// rowHash is the md5 of a single row along with its primary key values.
+type rowHash struct {
+	keys []any
+	hash string
+}
+
 // NewDB creates a DB instance from the given data source
 func NewDB(dsn string) (*DB, error) {
 	dbType := DatabaseDriverMysql
@@ -58,17 +134,100 @@ func NewDB(dsn string) (*DB, error) {
 		return nil, err
 	}
 
+	tag := make([]byte, 8)
+	if _, err := rand.Read(tag); err != nil {
+		return nil, fmt.Errorf("could not generate query tag: %w", err)
+	}
+
 	db, err := sqlx.Open(dbType, newDsn)
 	if err != nil {
 		return nil, err
 	}
 
+	host, database := dsnHost(dsn)
+
 	return &DB{
-		sqlDB:  db,
-		dbType: dbType,
+		sqlDB:   db,
+		dbType:  dbType,
+		tag:     hex.EncodeToString(tag),
+		retried: &retryCounts{tables: make(map[string]int)},
+		info: DatabaseInfo{
+			Driver:   dbType,
+			Host:     host,
+			Database: database,
+		},
 	}, nil
 }
 
+// Info returns the server version along with the redacted connection details.
+func (db *DB) Info() (DatabaseInfo, error) {
+	info := db.info
+
+	err := db.sqlDB.Get(&info.Version, "SELECT version()")
+	if err != nil {
+		return info, fmt.Errorf("could not get server version: %w", err)
+	}
+
+	return info, nil
+}
+
+// queryer runs the queries reading the data of the tables, it's either the
+// connection pool or the connection of a snapshot.
+type queryer interface {
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row
+}
+
+// conn returns the queryer the data of the tables is read through.
+func (db *DB) conn() queryer {
+	if db.snapshotConn != nil {
+		return db.snapshotConn
+	}
+
+	return db.sqlDB
+}
+
+// tagged prefixes the query with a comment holding the tag of the connection
+// pool, so that its running queries can be found by killQueries.
+func (db *DB) tagged(query string) string {
+	return "/* dbcmp:" + db.tag + " */ " + query
+}
+
+// killQueries stops the running queries of the connection pool. The mysql
+// driver only closes the connection of a cancelled query, the server would
+// keep running it until it's done. Postgres cancels the queries by itself.
+func (db *DB) killQueries() error {
+	if db.dbType != DatabaseDriverMysql {
+		return nil
+	}
+
+	// the context of the comparison is already done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var ids []int64
+	err := db.sqlDB.SelectContext(ctx, &ids, `SELECT ID FROM INFORMATION_SCHEMA.PROCESSLIST
+		WHERE INFO LIKE ? AND ID <> CONNECTION_ID()`, "%/* dbcmp:"+db.tag+" */%")
+	if err != nil {
+		return fmt.Errorf("could not list running queries: %w", err)
+	}
+
+	for _, id := range ids {
+		// the query might have completed in the meantime
+		_, err := db.sqlDB.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", id))
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrNoSuchThread {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not kill query: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (db *DB) Close() error {
 	if db.sqlDB != nil {
 		return nil
@@ -125,7 +284,7 @@ func (db *DB) dataTypes(table string) ([]*ColumnInfo, error) {
 
 	// with mysql-8, column_name is capitalized and it complains when
 	// querying like this. This works for both.
-	sqb := sqt.Select("column_name as column_name, data_type as data_type").
+	sqb := sqt.Select("column_name as column_name, data_type as data_type, is_nullable as is_nullable, column_default as column_default").
 		From("information_schema.columns").
 		Where(sq.And{sq.Eq{"table_name": table}})
 
@@ -153,21 +312,15 @@ func (db *DB) dataTypes(table string) ([]*ColumnInfo, error) {
 	return v, nil
 }
 
-func (db *DB) count(table *TableInfo) (int, error) {
+func (db *DB) count(ctx context.Context, table *TableInfo) (int, error) {
 	var query string
 	switch db.dbType {
 	case DatabaseDriverMysql:
 		query = "SELECT count(*) FROM " + table.TableName
 	case DatabaseDriverPostgres:
-		var currentSchema string
-		var schemaName sql.NullString
-		err := db.sqlDB.Get(&schemaName, "SELECT current_schema()")
+		currentSchema, err := db.currentSchema()
 		if err != nil {
-			return 0, fmt.Errorf("could not get current schema: %w", err)
-		} else if schemaName.String == "" {
-			currentSchema = "public"
-		} else {
-			currentSchema = schemaName.String
+			return 0, err
 		}
 		query = "SELECT count(*) FROM " + strings.Join([]string{currentSchema, table.TableName}, ".")
 	default:
@@ -175,7 +328,9 @@ func (db *DB) count(table *TableInfo) (int, error) {
 	}
 
 	var count int
-	err := db.sqlDB.Get(&count, query)
+	err := db.retry(ctx, table.TableName, query, func() error {
+		return db.conn().GetContext(ctx, &count, db.tagged(query))
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -183,15 +338,28 @@ func (db *DB) count(table *TableInfo) (int, error) {
 	return count, nil
 }
 
-func (db *DB) checksum(table *TableInfo, cursor cursorData) (string, cursorData, error) {
+// checksum computes the checksum of the given page. If the page has a limit,
+// the cursor of the next page is returned as well, it's empty once the end of
+// the table is reached. The checksum, the number of rows and the last key of
+// the page are selected with a single query.
+func (db *DB) checksum(ctx context.Context, table *TableInfo, cursor cursorData) (string, cursorData, error) {
 	q := struct {
 		TableName     string
+		KeyQuery      string
+		LastKeyQuery  string
+		LastKeyOrder  string
 		ColumnQuery   string
 		CurrentSchema string
 		CursorQuery   string
 	}{
-		TableName:   table.TableName,
-		ColumnQuery: generateQueryForColumns(db.dbType, table.Columns),
+		TableName:    table.TableName,
+		KeyQuery:     strings.Join(table.PrimaryKeys, ", "),
+		LastKeyQuery: "l." + strings.Join(table.PrimaryKeys, ", l."),
+		LastKeyOrder: orderBy(db.orderingKeys(table), "DESC"),
+		ColumnQuery:  generateQueryForColumns(db.dbType, table.Columns),
+	}
+	if len(table.PrimaryKeys) == 0 {
+		q.KeyQuery = ""
 	}
 
 	t := template.New("query")
@@ -205,15 +373,11 @@ func (db *DB) checksum(table *TableInfo, cursor cursorData) (string, cursorData,
 		tmpl = PostgresChecksumTmpl
 		// in addition to the template, postgres reuqies the selected schema id
 		// to access objects, it's generally public but it's not guaranteed
-		var schemaName sql.NullString
-		err := db.sqlDB.Get(&schemaName, "SELECT current_schema()")
+		currentSchema, err := db.currentSchema()
 		if err != nil {
-			return "", cursorData{}, fmt.Errorf("could not get current schema: %w", err)
-		} else if schemaName.String == "" {
-			q.CurrentSchema = "public"
-		} else {
-			q.CurrentSchema = schemaName.String
+			return "", cursorData{}, err
 		}
+		q.CurrentSchema = currentSchema
 	default:
 		return "", cursorData{}, fmt.Errorf("unrecognized database driver: %s", db.dbType)
 	}
@@ -225,117 +389,225 @@ func (db *DB) checksum(table *TableInfo, cursor cursorData) (string, cursorData,
 
 	// pagination query is basically the condtion for the WHERE statement for the
 	// checksum query.
-	paginationQuery, args, err := generateQueryForPagination(db.dbType, table.PrimaryKeys, cursor.cursors)
+	paginationQuery, args, err := generateQueryForPagination(db.dbType, db.orderingKeys(table), cursor.cursors, cursor.upper)
 	if err != nil {
 		return "", cursorData{}, fmt.Errorf("could not generate query for the cursor: %w", err)
 	}
-	paginationQuery = fmt.Sprintf("%s LIMIT %d", paginationQuery, cursor.limit)
+	if cursor.limit > 0 {
+		paginationQuery = fmt.Sprintf("%s LIMIT %d", paginationQuery, cursor.limit)
+	}
 	q.CursorQuery = paginationQuery
 
+	// mysql selects the page twice, so are the arguments
+	if db.dbType == DatabaseDriverMysql && q.KeyQuery != "" {
+		args = append(args, args...)
+	}
+
 	out := bytes.NewBufferString("")
 	err = t.Execute(out, q)
 	if err != nil {
 		return "", cursorData{}, fmt.Errorf("could not execute template: %w", err)
 	}
 
-	var ints = struct {
-		A uint `db:"a"`
-		B uint `db:"b"`
-		C uint `db:"c"`
-		D uint `db:"d"`
-	}{}
-	err = db.sqlDB.Get(&ints, out.String(), args...)
+	// sums are NULL when there are no rows in the page, so is the last key
+	var a, b, c, d sql.NullInt64
+	var count int
+	keys := make([]any, len(table.PrimaryKeys))
+	dest := []any{&a, &b, &c, &d, &count}
+	for i := range keys {
+		dest = append(dest, &keys[i])
+	}
+
+	err = db.retry(ctx, table.TableName, out.String(), func() error {
+		return db.conn().QueryRowContext(ctx, db.tagged(out.String()), args...).Scan(dest...)
+	})
 	if err != nil {
 		return "", cursorData{}, fmt.Errorf("could not select checksum: %w", err)
 	}
 	// we convert the result to a string, it's easier to compare
-	result := fmt.Sprintf("%d%d%d%d", ints.A, ints.B, ints.C, ints.D)
+	result := fmt.Sprintf("%d%d%d%d", a.Int64, b.Int64, c.Int64, d.Int64)
 
-	// the remaining part is about determining the next cursors.
-	// since we don't actually read any rows from the tables for sum operation,
-	// we simply need to pick required rows from the query executed above.
-	var c sq.And
-	for i := range cursor.cursors {
-		c = append(c, sq.Gt{table.PrimaryKeys[i]: cursor.cursors[i]})
+	// a range without a limit is read as a whole, there is no next page. If
+	// the page is not full, we are already at the end of the cursor.
+	if cursor.limit == 0 || count < cursor.limit {
+		return result, cursorData{}, nil
 	}
 
-	builder := sq.StatementBuilder.PlaceholderFormat(sq.Question)
-	tableName := table.TableName
-	if db.dbType == DatabaseDriverPostgres {
-		builder = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-		tableName = strings.Join([]string{q.CurrentSchema, tableName}, ".")
+	for i := range keys {
+		keys[i] = normalizeValue(keys[i])
 	}
 
-	cursorQueryBuilder := builder.
-		Select(table.PrimaryKeys...).
-		From(tableName).
-		Where(c).
-		OrderBy(strings.Join(table.PrimaryKeys, ",") + " ASC").
-		Limit(uint64(cursor.limit))
+	return result, cursorData{
+		cursors: keys,
+		limit:   count,
+	}, nil
+}
+
+// orderingKeys returns the expressions of the primary keys the pages are
+// ordered and bounded by. The string keys are compared byte-wise if the
+// binaryKeyOrder is set, otherwise the keys are used as they are so that the
+// databases can page through the primary key indexes.
+func (db *DB) orderingKeys(table *TableInfo) []string {
+	if !db.binaryKeyOrder {
+		return table.PrimaryKeys
+	}
 
-	// if we don't have anything for a where condtion, we avoid adding it.
-	if cursor.cursors == nil {
-		cursorQueryBuilder = builder.
-			Select(table.PrimaryKeys...).
-			From(tableName).
-			OrderBy(strings.Join(table.PrimaryKeys, ",") + " ASC").
-			Limit(uint64(cursor.limit))
+	types := make(map[string]string, len(table.Columns))
+	for _, c := range table.Columns {
+		types[strings.ToLower(c.ColumnName)] = normalizeDataType(c.DataType)
 	}
 
-	// to determine whether we should continue iterating the cursor,
-	// we get the count of remained rows here
-	cursorCountQueryBuilder := builder.
-		Select("COUNT(*)").
-		FromSelect(cursorQueryBuilder, "q2")
+	keys := make([]string, len(table.PrimaryKeys))
+	for i, pk := range table.PrimaryKeys {
+		switch types[strings.ToLower(pk)] {
+		case "varchar", "char", "text":
+			keys[i] = binaryOrdered(db.dbType, pk)
+		default:
+			keys[i] = pk
+		}
+	}
+
+	return keys
+}
 
-	cursorCountQuery, cursorCountArgs, err := cursorCountQueryBuilder.ToSql()
+// countRange returns the number of rows in the given page.
+func (db *DB) countRange(ctx context.Context, table *TableInfo, cursor cursorData) (int, error) {
+	tableName := table.TableName
+	if db.dbType == DatabaseDriverPostgres {
+		currentSchema, err := db.currentSchema()
+		if err != nil {
+			return 0, err
+		}
+		tableName = strings.Join([]string{currentSchema, tableName}, ".")
+	}
+
+	paginationQuery, args, err := generateQueryForPagination(db.dbType, db.orderingKeys(table), cursor.cursors, cursor.upper)
 	if err != nil {
-		return "", cursorData{}, fmt.Errorf("could not build cursor query: %w", err)
+		return 0, fmt.Errorf("could not generate query for the cursor: %w", err)
+	}
+	if cursor.limit > 0 {
+		paginationQuery = fmt.Sprintf("%s LIMIT %d", paginationQuery, cursor.limit)
 	}
 
 	var count int
-	err = db.sqlDB.Get(&count, cursorCountQuery, cursorCountArgs...)
+	query := fmt.Sprintf("SELECT count(*) FROM (SELECT 1 AS one FROM %s %s) AS q", tableName, paginationQuery)
+	err = db.retry(ctx, table.TableName, query, func() error {
+		return db.conn().GetContext(ctx, &count, db.tagged(query), args...)
+	})
 	if err != nil {
-		return "", cursorData{}, fmt.Errorf("could not select cursors: %w", err)
+		return 0, fmt.Errorf("could not count rows: %w", err)
 	}
 
-	// we break here because that means the items received from the previous call
-	// was the last remaining rows from the cursor.
-	// in short, it means that we are already at the end of the cursor
-	if count < cursor.limit {
-		return result, cursorData{}, nil
-	}
+	return count, nil
+}
 
-	cursors := []any{}
-	// We can't scan a single row into a slice, it needs to be a struct.
-	// In our case we have no idea what the struct would look like as
-	// there can be many primary keys. As a workaround we select individual
-	// primary key and append it to the cursors slice
-	for _, pk := range table.PrimaryKeys {
-		lastCursorQueryBuilder := builder.
-			Select(pk).
-			FromSelect(cursorQueryBuilder, "q1").
-			OrderBy(strings.Join(table.PrimaryKeys, ",") + " DESC").
-			Limit(1)
+// rowHashes returns the primary key values and the md5 of every row in the
+// given page, ordered by the primary keys.
+func (db *DB) rowHashes(ctx context.Context, table *TableInfo, cursor cursorData) ([]rowHash, error) {
+	q := struct {
+		TableName     string
+		KeyQuery      string
+		ColumnQuery   string
+		CurrentSchema string
+		CursorQuery   string
+	}{
+		TableName:   table.TableName,
+		KeyQuery:    strings.Join(table.PrimaryKeys, ", "),
+		ColumnQuery: generateQueryForColumns(db.dbType, table.Columns),
+	}
 
-		lastCursorQuery, lastCursorArgs, err := lastCursorQueryBuilder.ToSql()
+	var tmpl string
+	switch db.dbType {
+	case DatabaseDriverMysql:
+		tmpl = MySQLRowHashTmpl
+	case DatabaseDriverPostgres:
+		tmpl = PostgresRowHashTmpl
+		currentSchema, err := db.currentSchema()
 		if err != nil {
-			return "", cursorData{}, fmt.Errorf("could not build cursor query: %w", err)
+			return nil, err
 		}
+		q.CurrentSchema = currentSchema
+	default:
+		return nil, fmt.Errorf("unrecognized database driver: %s", db.dbType)
+	}
 
-		var c any
-		err = db.sqlDB.Get(&c, lastCursorQuery, lastCursorArgs...)
+	t, err := template.New("query").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	paginationQuery, args, err := generateQueryForPagination(db.dbType, db.orderingKeys(table), cursor.cursors, cursor.upper)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate query for the cursor: %w", err)
+	}
+	if cursor.limit > 0 {
+		paginationQuery = fmt.Sprintf("%s LIMIT %d", paginationQuery, cursor.limit)
+	}
+	q.CursorQuery = paginationQuery
+
+	out := bytes.NewBufferString("")
+	err = t.Execute(out, q)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute template: %w", err)
+	}
+
+	var hashes []rowHash
+	err = db.retry(ctx, table.TableName, out.String(), func() error {
+		hashes = nil
+		rows, err := db.conn().QueryxContext(ctx, db.tagged(out.String()), args...)
 		if err != nil {
-			return "", cursorData{}, fmt.Errorf("could not select cursors: %w", err)
+			return fmt.Errorf("could not select row hashes: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			values, err := rows.SliceScan()
+			if err != nil {
+				return fmt.Errorf("could not scan row hash: %w", err)
+			}
+
+			// the hash is always the last column, the rest are the primary keys
+			n := len(values) - 1
+			keys := make([]any, n)
+			for i := 0; i < n; i++ {
+				keys[i] = normalizeValue(values[i])
+			}
+			hashes = append(hashes, rowHash{
+				keys: keys,
+				hash: fmt.Sprint(normalizeValue(values[n])),
+			})
 		}
 
-		cursors = append(cursors, c)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return result, cursorData{
-		cursors: cursors,
-		limit:   count,
-	}, nil
+	return hashes, nil
+}
+
+// currentSchema returns the schema selected for the postgres connection. It's
+// generally public but it's not guaranteed.
+func (db *DB) currentSchema() (string, error) {
+	db.schemaMu.Lock()
+	defer db.schemaMu.Unlock()
+
+	if db.schema != "" {
+		return db.schema, nil
+	}
+
+	var schemaName sql.NullString
+	err := db.sqlDB.Get(&schemaName, "SELECT current_schema()")
+	if err != nil {
+		return "", fmt.Errorf("could not get current schema: %w", err)
+	} else if schemaName.String == "" {
+		db.schema = "public"
+	} else {
+		db.schema = schemaName.String
+	}
+
+	return db.schema, nil
 }
 
 // pirmaryKeys returns the primary keys of a table. Essentially we want to
@@ -345,16 +617,19 @@ func (db *DB) primaryKeys(tableName string) ([]string, error) {
 	pks := []string{}
 	switch db.dbType {
 	case DatabaseDriverMysql:
+		// the key columns are ordered as they are defined in the primary key
 		query := `SELECT 
 			COLUMN_NAME
 		FROM 
-			INFORMATION_SCHEMA.COLUMNS
+			INFORMATION_SCHEMA.KEY_COLUMN_USAGE
 		WHERE 
 			TABLE_SCHEMA = DATABASE()
 		AND 
 			TABLE_NAME = ?
 		AND
-			COLUMN_KEY = 'PRI'`
+			CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY
+			ORDINAL_POSITION`
 
 		err := db.sqlDB.Select(&pks, query, tableName)
 		if err != nil {
@@ -362,15 +637,9 @@ func (db *DB) primaryKeys(tableName string) ([]string, error) {
 		}
 
 	case DatabaseDriverPostgres:
-		var currentSchema string
-		var schemaName sql.NullString
-		err := db.sqlDB.Get(&schemaName, "SELECT current_schema()")
+		currentSchema, err := db.currentSchema()
 		if err != nil {
-			return nil, fmt.Errorf("could not get current schema: %w", err)
-		} else if schemaName.String == "" {
-			currentSchema = "public"
-		} else {
-			currentSchema = schemaName.String
+			return nil, err
 		}
 		// interestingly postgres append schema name into the attname
 		// hence we prefix the currentSchema name to the table name
@@ -389,7 +658,9 @@ func (db *DB) primaryKeys(tableName string) ([]string, error) {
 		AND
 			pg_attribute.attnum = any(pg_index.indkey)
 		AND
-			indisprimary`
+			indisprimary
+		ORDER BY
+			array_position(pg_index.indkey::int2[], pg_attribute.attnum)`
 		err = db.sqlDB.Select(&pks, query, strings.Join([]string{currentSchema, tableName}, "."))
 		if err != nil {
 			return nil, err
@@ -400,3 +671,79 @@ func (db *DB) primaryKeys(tableName string) ([]string, error) {
 
 	return pks, nil
 }
+
+// indexes returns the indexes of a table, including the primary key and the
+// ones backing the unique constraints. Expression indexes are left out.
+func (db *DB) indexes(tableName string) ([]*IndexInfo, error) {
+	var query string
+	var args []any
+	switch db.dbType {
+	case DatabaseDriverMysql:
+		query = `SELECT
+			INDEX_NAME AS index_name,
+			COLUMN_NAME AS column_name,
+			NON_UNIQUE = 0 AS is_unique,
+			INDEX_NAME = 'PRIMARY' AS is_primary
+		FROM
+			INFORMATION_SCHEMA.STATISTICS
+		WHERE
+			TABLE_SCHEMA = DATABASE()
+		AND
+			TABLE_NAME = ?
+		AND
+			COLUMN_NAME IS NOT NULL
+		ORDER BY
+			INDEX_NAME, SEQ_IN_INDEX`
+		args = []any{tableName}
+	case DatabaseDriverPostgres:
+		currentSchema, err := db.currentSchema()
+		if err != nil {
+			return nil, err
+		}
+		query = `SELECT
+			i.relname AS index_name,
+			a.attname AS column_name,
+			ix.indisunique AS is_unique,
+			ix.indisprimary AS is_primary
+		FROM
+			pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = any(ix.indkey)
+		WHERE
+			ix.indrelid = $1 ::regclass
+		ORDER BY
+			i.relname, array_position(ix.indkey::int2[], a.attnum)`
+		args = []any{strings.Join([]string{currentSchema, tableName}, ".")}
+	default:
+		return nil, errors.New("could not list indexes: unknown database driver")
+	}
+
+	var rows []struct {
+		IndexName  string `db:"index_name"`
+		ColumnName string `db:"column_name"`
+		IsUnique   bool   `db:"is_unique"`
+		IsPrimary  bool   `db:"is_primary"`
+	}
+	err := db.sqlDB.Select(&rows, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []*IndexInfo
+	byName := make(map[string]*IndexInfo)
+	for _, r := range rows {
+		idx, ok := byName[r.IndexName]
+		if !ok {
+			idx = &IndexInfo{
+				IndexName: r.IndexName,
+				Unique:    r.IsUnique,
+				Primary:   r.IsPrimary,
+			}
+			byName[r.IndexName] = idx
+			indexes = append(indexes, idx)
+		}
+		idx.Columns = append(idx.Columns, r.ColumnName)
+	}
+
+	return indexes, nil
+}
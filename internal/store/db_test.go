@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"math/rand"
 	"testing"
 
@@ -30,7 +31,7 @@ func TestTableCount(t *testing.T) {
 		tables, err := db.TableList()
 		require.NoError(t, err)
 
-		c, err := db.count(tables["table1"])
+		c, err := db.count(context.Background(), tables["table1"])
 		require.NoError(t, err)
 		require.Equal(t, ec, c)
 	})
@@ -45,7 +46,7 @@ func TestCheksum(t *testing.T) {
 		tables, err := db.TableList()
 		require.NoError(t, err)
 
-		sum, _, err := db.checksum(tables["table1"], cursorData{
+		sum, _, err := db.checksum(context.Background(), tables["table1"], cursorData{
 			limit: 100,
 		})
 		require.NoError(t, err)
@@ -53,6 +54,45 @@ func TestCheksum(t *testing.T) {
 	})
 }
 
+func TestChecksumPagination(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(23)
+	defer h.Teardown()
+
+	h.RunForAllDrivers(t, func(t *testing.T, db *DB) {
+		tables, err := db.TableList()
+		require.NoError(t, err)
+
+		table := tables["table1"]
+		rows, err := db.rowHashes(context.Background(), table, cursorData{})
+		require.NoError(t, err)
+		require.Len(t, rows, 23)
+
+		// each full page advances the cursor to its last key, the last page
+		// is not full and ends the table.
+		cursor := cursorData{limit: 5}
+		for i := 5; i <= 20; i += 5 {
+			_, next, err := db.checksum(context.Background(), table, cursor)
+			require.NoError(t, err)
+			require.Equal(t, rows[i-1].keys, next.cursors)
+			require.Equal(t, 5, next.limit)
+			require.Nil(t, next.upper)
+			cursor = next
+		}
+
+		sum, next, err := db.checksum(context.Background(), table, cursor)
+		require.NoError(t, err)
+		require.NotEmpty(t, sum)
+		require.Nil(t, next.cursors)
+		require.Zero(t, next.limit)
+
+		// a page starting at the last key is empty
+		_, next, err = db.checksum(context.Background(), table, cursorData{cursors: rows[22].keys, limit: 5})
+		require.NoError(t, err)
+		require.Nil(t, next.cursors)
+		require.Zero(t, next.limit)
+	})
+}
+
 func TestPrimaryKeys(t *testing.T) {
 	h := newTestHelper(t)
 	defer h.Teardown()
@@ -69,3 +109,41 @@ func TestPrimaryKeys(t *testing.T) {
 		}
 	})
 }
+
+func TestCompositeKeyPagination(t *testing.T) {
+	h := newTestHelper(t).SeedCompositeKeyData(5, 7)
+	defer h.Teardown()
+
+	h.RunForAllDrivers(t, func(t *testing.T, db *DB) {
+		tables, err := db.TableList()
+		require.NoError(t, err)
+
+		table := tables["table2"]
+		require.Len(t, table.PrimaryKeys, 2)
+
+		// every row should be visited exactly once even though the pages
+		// end in the middle of the rows sharing the same leading key.
+		seen := make(map[string]struct{})
+		cursor := cursorData{limit: 4}
+		for {
+			rows, err := db.rowHashes(context.Background(), table, cursor)
+			require.NoError(t, err)
+
+			_, next, err := db.checksum(context.Background(), table, cursor)
+			require.NoError(t, err)
+
+			for _, r := range rows {
+				k := keyString(r.keys)
+				require.NotContains(t, seen, k)
+				seen[k] = struct{}{}
+			}
+
+			if next.cursors == nil {
+				break
+			}
+			cursor = next
+		}
+
+		require.Len(t, seen, 35)
+	})
+}
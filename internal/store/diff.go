@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TableDiff describes the rows of a table that differ between the source and
+// the target databases. Each key holds the values of the PrimaryKeys in order.
+type TableDiff struct {
+	TableName   string
+	PrimaryKeys []string
+	// Missing are the keys of the rows that exist in the source but not in the target.
+	Missing [][]any
+	// Extra are the keys of the rows that exist in the target but not in the source.
+	Extra [][]any
+	// Changed are the keys of the rows that exist on both sides with different values.
+	Changed [][]any
+	// Pages are the key ranges of the pages where the differences are found.
+	Pages []KeyRange
+}
+
+// Empty returns true if there are no differing rows.
+func (d *TableDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the tables page by page like Compare does, but whenever a page
+// checksum mismatches it compares the rows of that page one by one to find out
+// which primary keys are missing, extra or changed in the target. Only the
+// tables having differences are returned, along with the warnings such as the
+// tables skipped for having no key.
+func Diff(ctx context.Context, srcDSN, dstDSN string, opts CompareOptions) ([]*TableDiff, []string, error) {
+	srcdb, dstdb, err := openDatabases(srcDSN, dstDSN, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer srcdb.sqlDB.Close()
+	defer dstdb.sqlDB.Close()
+
+	stop := killQueriesOnDone(ctx, srcdb, dstdb)
+	defer stop()
+
+	var diffs []*TableDiff
+	warnings, err := diffTables(ctx, srcdb, dstdb, opts, func(_, _ *TableInfo, d *TableDiff) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	return diffs, warnings, nil
+}
+
+// diffTables diffs the tables one by one and passes the differing ones to fn
+// along with the source and the target tables. The rows can't be told apart
+// without a key, there are none to compare with in a missing target table and
+// all of them differ if the columns do, such tables are skipped with a
+// warning.
+func diffTables(ctx context.Context, srcdb, dstdb *DB, opts CompareOptions, fn func(src, dst *TableInfo, d *TableDiff) error) ([]string, error) {
+	srcTables, dstTables, _, err := listTables(srcdb, dstdb, opts.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, k := range sortedTableNames(srcTables) {
+		v := srcTables[k]
+		v2, ok := dstTables[strings.ToLower(k)]
+		if !ok {
+			// the table is counted like Compare does, there are no rows to
+			// diff against.
+			tr, err := missingTable(ctx, srcdb, v, TableStatusMissingInTarget)
+			if err != nil {
+				return warnings, err
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: missing in target with %d rows, the table is skipped", v.TableName, tr.SourceRows))
+			continue
+		}
+
+		// every row of the tables with different columns would differ, the
+		// same preflight as Compare's is made first.
+		src, dst, schemaDiffs := preflight(v, v2, opts.CommonColumns)
+		for _, d := range schemaDiffs {
+			warnings = append(warnings, d.String())
+		}
+		if src == nil {
+			warnings = append(warnings, fmt.Sprintf("%s: the schemas differ, the table is skipped", v.TableName))
+			continue
+		}
+		v, v2 = src, dst
+
+		v, v2, warning, err := keyedTables(srcdb, dstdb, v, v2, opts.orderingKey(v.TableName))
+		if err != nil {
+			return warnings, fmt.Errorf("could not determine the keys of %q: %w", k, err)
+		} else if len(v.PrimaryKeys) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no primary key or unique index, the table is skipped", v.TableName))
+			continue
+		} else if warning != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", v.TableName, warning))
+		}
+
+		d, err := diffTable(ctx, srcdb, dstdb, v, v2, opts.PageSize)
+		if err != nil {
+			return warnings, fmt.Errorf("could not diff %q: %w", v.TableName, err)
+		} else if d.Empty() {
+			continue
+		}
+
+		err = fn(v, v2, d)
+		if err != nil {
+			return warnings, err
+		}
+	}
+
+	return warnings, nil
+}
+
+// diffTable compares the row hashes of the mismatching pages of a table.
+func diffTable(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, pageSize int) (*TableDiff, error) {
+	d := &TableDiff{
+		TableName:   src.TableName,
+		PrimaryKeys: src.PrimaryKeys,
+	}
+
+	err := walkPages(ctx, srcdb, dstdb, src, dst, KeyRange{}, pageSize, func(page cursorData, equal bool) (bool, error) {
+		if equal {
+			return true, nil
+		}
+
+		d.Pages = append(d.Pages, KeyRange{From: page.cursors, To: page.upper})
+		return true, diffRows(ctx, srcdb, dstdb, src, dst, page, d)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// diffRows compares the row hashes of a page and appends the differing keys
+// to the given TableDiff.
+func diffRows(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, page cursorData, d *TableDiff) error {
+	srcRows, err := srcdb.rowHashes(ctx, src, page)
+	if err != nil {
+		return fmt.Errorf("could not compute src row hashes: %w", err)
+	}
+
+	dstRows, err := dstdb.rowHashes(ctx, dst, page)
+	if err != nil {
+		return fmt.Errorf("could not compute dst row hashes: %w", err)
+	}
+
+	dstHashes := make(map[string]string, len(dstRows))
+	for _, r := range dstRows {
+		dstHashes[keyString(r.keys)] = r.hash
+	}
+
+	seen := make(map[string]struct{}, len(srcRows))
+	for _, r := range srcRows {
+		k := keyString(r.keys)
+		seen[k] = struct{}{}
+
+		hash, ok := dstHashes[k]
+		if !ok {
+			d.Missing = append(d.Missing, r.keys)
+		} else if hash != r.hash {
+			d.Changed = append(d.Changed, r.keys)
+		}
+	}
+
+	for _, r := range dstRows {
+		if _, ok := seen[keyString(r.keys)]; !ok {
+			d.Extra = append(d.Extra, r.keys)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	ec := rand.Intn(100) + 20 // we add 20 to ensure pagination gets triggered
+	h := newTestHelper(t).SeedTableData(ec)
+	defer h.Teardown()
+
+	diffs, _, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	mysqldb, ok := h.dbInstances["mysql"]
+	require.True(t, ok)
+
+	var ids []string
+	err = mysqldb.sqlDB.Select(&ids, "SELECT Id FROM Table1 ORDER BY Id LIMIT 2")
+	require.NoError(t, err)
+
+	// one row is deleted, another one is changed and a new one is added
+	_, err = mysqldb.sqlDB.Exec("DELETE FROM Table1 WHERE Id = ?", ids[0])
+	require.NoError(t, err)
+	_, err = mysqldb.sqlDB.Exec("UPDATE Table1 SET Name = 'changed' WHERE Id = ?", ids[1])
+	require.NoError(t, err)
+	extraId := newId()
+	_, err = mysqldb.sqlDB.Exec("INSERT INTO Table1 (Id, CreateAt, Name, Description) VALUES (?, 1, 'extra', 'extra')", extraId)
+	require.NoError(t, err)
+
+	diffs, _, err = Diff(context.Background(), pgsqlTestDSN, mysqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	require.Equal(t, [][]any{{ids[0]}}, diffs[0].Missing)
+	require.Equal(t, [][]any{{ids[1]}}, diffs[0].Changed)
+	require.Equal(t, [][]any{{extraId}}, diffs[0].Extra)
+}
+
+func TestDiffWithoutPrimaryKey(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	for name, instance := range h.dbInstances {
+		for _, q := range []string{
+			"CREATE TABLE Table4 (Name varchar(26), Value integer)",
+			"INSERT INTO Table4 (Name, Value) VALUES ('a', 1), ('a', 1), ('b', NULL)",
+		} {
+			_, err := instance.sqlDB.Exec(q)
+			require.NoError(t, err, "could not execute %q on %q", q, name)
+		}
+	}
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("DELETE FROM Table1 WHERE Id IN (SELECT Id FROM Table1 LIMIT 1)")
+	require.NoError(t, err)
+
+	// the other tables are still diffed
+	diffs, warnings, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	require.Len(t, diffs[0].Missing, 1)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "the table is skipped")
+
+	repairs, warnings, err := Repair(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, repairs, 1)
+	require.Equal(t, 1, repairs[0].Inserts)
+	require.Len(t, warnings, 1)
+}
+
+func TestDiffMissingTable(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	mysqldb, ok := h.dbInstances["mysql"]
+	require.True(t, ok)
+
+	for _, q := range []string{
+		"CREATE TABLE Table3 (Id varchar(26) NOT NULL PRIMARY KEY, Value integer)",
+		"INSERT INTO Table3 (Id, Value) VALUES ('a', 1), ('b', 2)",
+	} {
+		_, err := mysqldb.sqlDB.Exec(q)
+		require.NoError(t, err)
+	}
+
+	diffs, warnings, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+	require.Equal(t, []string{"Table3: missing in target with 2 rows, the table is skipped"}, warnings)
+}
+
+func TestDiffSchemaMismatch(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("ALTER TABLE Table1 ADD COLUMN Extra integer")
+	require.NoError(t, err)
+
+	// the rows would all differ by the extra column
+	diffs, warnings, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[1], "the schemas differ, the table is skipped")
+
+	diffs, warnings, err = Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize:      20,
+		CommonColumns: true,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+	require.Len(t, warnings, 1)
+}
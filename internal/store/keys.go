@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyedTables makes sure the rows of the tables can be told apart. If the
+// orderingKey is given, the tables are keyed by these columns once they are
+// verified to be a unique index on both sides. The tables without a primary
+// key are keyed by a unique index of non-null columns that exists on both
+// sides instead. If there is no such index, the returned tables have no keys
+// and they can only be compared as a whole. A warning is returned if the
+// tables are keyed by neither their primary keys nor the orderingKey.
+func keyedTables(srcdb, dstdb *DB, src, dst *TableInfo, orderingKey []string) (*TableInfo, *TableInfo, string, error) {
+	if len(src.PrimaryKeys) > 0 && len(orderingKey) == 0 {
+		return src, dst, "", nil
+	}
+
+	srcIndexes, err := srcdb.indexes(src.TableName)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("could not list src indexes: %w", err)
+	}
+
+	dstIndexes, err := dstdb.indexes(dst.TableName)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("could not list dst indexes: %w", err)
+	}
+
+	if len(orderingKey) > 0 {
+		s, err := withKey(src, srcIndexes, orderingKey)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("invalid src ordering key: %w", err)
+		}
+
+		d, err := withKey(dst, dstIndexes, orderingKey)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("invalid dst ordering key: %w", err)
+		}
+
+		return s, d, "", nil
+	}
+
+	dstKeys := make(map[string][]string)
+	for _, idx := range dstIndexes {
+		if idx.Unique && notNullColumns(dst, idx.Columns) {
+			dstKeys[strings.ToLower(strings.Join(idx.Columns, ","))] = idx.Columns
+		}
+	}
+
+	// the narrowest index is preferred, the name breaks the ties so that
+	// the same index is picked on every run.
+	sort.SliceStable(srcIndexes, func(i, j int) bool {
+		if len(srcIndexes[i].Columns) != len(srcIndexes[j].Columns) {
+			return len(srcIndexes[i].Columns) < len(srcIndexes[j].Columns)
+		}
+		return srcIndexes[i].IndexName < srcIndexes[j].IndexName
+	})
+
+	for _, idx := range srcIndexes {
+		if !idx.Unique || !notNullColumns(src, idx.Columns) {
+			continue
+		}
+
+		dstColumns, ok := dstKeys[strings.ToLower(strings.Join(idx.Columns, ","))]
+		if !ok {
+			continue
+		}
+
+		s, d := *src, *dst
+		s.PrimaryKeys = idx.Columns
+		d.PrimaryKeys = dstColumns
+
+		return &s, &d, fmt.Sprintf("no primary key, compared by the unique index %s (%s)", idx.IndexName, strings.Join(idx.Columns, ", ")), nil
+	}
+
+	return src, dst, "no primary key or unique index, compared without a key", nil
+}
+
+// withKey returns a copy of the table keyed by the given columns. The columns
+// must be non-null and contain every column of a unique index of the table,
+// such as the primary key, in any order.
+func withKey(table *TableInfo, indexes []*IndexInfo, key []string) (*TableInfo, error) {
+	columns := make(map[string]string, len(table.Columns))
+	for _, c := range table.Columns {
+		columns[strings.ToLower(c.ColumnName)] = c.ColumnName
+	}
+
+	keys := make([]string, len(key))
+	for i, k := range key {
+		c, ok := columns[strings.ToLower(k)]
+		if !ok {
+			return nil, fmt.Errorf("column %q is not found in %q", k, table.TableName)
+		}
+		keys[i] = c
+	}
+
+	if !notNullColumns(table, keys) {
+		return nil, fmt.Errorf("columns (%s) of %q accept NULL values", strings.Join(keys, ", "), table.TableName)
+	}
+
+	for _, idx := range indexes {
+		if idx.Unique && containsColumns(keys, idx.Columns) {
+			t := *table
+			t.PrimaryKeys = keys
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("columns (%s) of %q don't contain a unique index", strings.Join(keys, ", "), table.TableName)
+}
+
+// containsColumns returns true if all of the columns are in the set regardless
+// of their order and case.
+func containsColumns(set, columns []string) bool {
+	s := make(map[string]struct{}, len(set))
+	for _, c := range set {
+		s[strings.ToLower(c)] = struct{}{}
+	}
+	for _, c := range columns {
+		if _, ok := s[strings.ToLower(c)]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notNullColumns returns true if all of the columns exist in the table and
+// none of them accepts NULL values.
+func notNullColumns(table *TableInfo, columns []string) bool {
+	nullable := make(map[string]bool, len(table.Columns))
+	for _, c := range table.Columns {
+		nullable[strings.ToLower(c.ColumnName)] = c.Nullable()
+	}
+
+	for _, c := range columns {
+		n, ok := nullable[strings.ToLower(c)]
+		if !ok || n {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithKey(t *testing.T) {
+	table := &TableInfo{
+		TableName:   "Posts",
+		PrimaryKeys: []string{"Id"},
+		Columns: []*ColumnInfo{
+			{ColumnName: "Id", DataType: "varchar", IsNullable: "NO"},
+			{ColumnName: "CreateAt", DataType: "bigint", IsNullable: "NO"},
+			{ColumnName: "DeleteAt", DataType: "bigint", IsNullable: "YES"},
+		},
+	}
+	// the indexes of the Posts table of Mattermost on the columns above
+	indexes := []*IndexInfo{
+		{IndexName: "PRIMARY", Columns: []string{"Id"}, Unique: true, Primary: true},
+		{IndexName: "idx_posts_create_at", Columns: []string{"CreateAt"}},
+		{IndexName: "idx_posts_delete_at", Columns: []string{"DeleteAt"}},
+		{IndexName: "idx_posts_create_at_id", Columns: []string{"CreateAt", "Id"}},
+	}
+
+	keyed, err := withKey(table, indexes, []string{"createat", "id"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"CreateAt", "Id"}, keyed.PrimaryKeys)
+	require.Equal(t, []string{"Id"}, table.PrimaryKeys)
+
+	keyed, err = withKey(table, indexes, []string{"Id"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Id"}, keyed.PrimaryKeys)
+
+	_, err = withKey(table, indexes, []string{"CreateAt"})
+	require.ErrorContains(t, err, "don't contain a unique index")
+
+	_, err = withKey(table, indexes, []string{"DeleteAt", "Id"})
+	require.ErrorContains(t, err, "accept NULL values")
+
+	_, err = withKey(table, indexes, []string{"UpdateAt"})
+	require.ErrorContains(t, err, "not found")
+}
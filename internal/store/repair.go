@@ -0,0 +1,408 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// repairFetchSize is the number of source rows fetched at once to generate
+// the INSERT and UPDATE statements.
+const repairFetchSize = 100
+
+// TableRepair contains the statements that bring a target table in line
+// with the source. Statements are in the dialect of the target database.
+type TableRepair struct {
+	TableName  string
+	Statements []string
+	Inserts    int
+	Updates    int
+	Deletes    int
+	// Pages are the key ranges of the source pages being repaired.
+	Pages []KeyRange
+}
+
+// Repair finds the differing rows like Diff does and generates the INSERT,
+// UPDATE and DELETE statements to apply on the target. The target is never
+// modified. Only the tables having differences are returned, along with the
+// warnings of Diff.
+func Repair(ctx context.Context, srcDSN, dstDSN string, opts CompareOptions) ([]*TableRepair, []string, error) {
+	srcdb, dstdb, err := openDatabases(srcDSN, dstDSN, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer srcdb.sqlDB.Close()
+	defer dstdb.sqlDB.Close()
+
+	stop := killQueriesOnDone(ctx, srcdb, dstdb)
+	defer stop()
+
+	var repairs []*TableRepair
+	warnings, err := repairTables(ctx, srcdb, dstdb, opts, func(_, _ *TableInfo, r *TableRepair) error {
+		repairs = append(repairs, r)
+		return nil
+	})
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	return repairs, warnings, nil
+}
+
+// repairTables generates the repair statements of each differing table and
+// passes them to fn along with the source and the target tables. The tables
+// are diffed by diffTables, so are the warnings.
+func repairTables(ctx context.Context, srcdb, dstdb *DB, opts CompareOptions, fn func(src, dst *TableInfo, r *TableRepair) error) ([]string, error) {
+	return diffTables(ctx, srcdb, dstdb, opts, func(src, dst *TableInfo, d *TableDiff) error {
+		r, err := repairTable(ctx, srcdb, dstdb.dbType, src, dst, d)
+		if err != nil {
+			return fmt.Errorf("could not generate repair statements for %q: %w", src.TableName, err)
+		}
+
+		return fn(src, dst, r)
+	})
+}
+
+// repairTable generates the statements for the differing rows of a table,
+// the missing and changed rows are read from the source. The statements are
+// the DELETEs, then the UPDATEs and then the INSERTs.
+func repairTable(ctx context.Context, srcdb *DB, dstDriver string, src, dst *TableInfo, d *TableDiff) (*TableRepair, error) {
+	r := &TableRepair{
+		TableName: dst.TableName,
+		Pages:     d.Pages,
+	}
+
+	// the target columns are matched by name, the case can differ between
+	// the dialects.
+	dstColumns := make(map[string]*ColumnInfo, len(dst.Columns))
+	for _, c := range dst.Columns {
+		dstColumns[strings.ToLower(c.ColumnName)] = c
+	}
+	columns := make([]*ColumnInfo, len(src.Columns))
+	for i, c := range src.Columns {
+		dc, ok := dstColumns[strings.ToLower(c.ColumnName)]
+		if !ok {
+			return nil, fmt.Errorf("column %q is not found in dst table", c.ColumnName)
+		}
+		columns[i] = dc
+	}
+
+	keyColumns := make([]*ColumnInfo, len(src.PrimaryKeys))
+	for i, pk := range src.PrimaryKeys {
+		dc, ok := dstColumns[strings.ToLower(pk)]
+		if !ok {
+			return nil, fmt.Errorf("primary key %q is not found in dst table", pk)
+		}
+		keyColumns[i] = dc
+	}
+
+	rows, err := srcdb.rowsByKeys(ctx, src, append(append([][]any{}, d.Missing...), d.Changed...))
+	if err != nil {
+		return nil, fmt.Errorf("could not read source rows: %w", err)
+	}
+
+	// the extra rows are deleted and the changed ones updated first, they
+	// might hold the unique values of the missing rows.
+	for _, key := range d.Extra {
+		where, err := keyCondition(dstDriver, keyColumns, key)
+		if err != nil {
+			return nil, err
+		}
+		r.Statements = append(r.Statements, fmt.Sprintf("DELETE FROM %s WHERE %s;", quoteIdentifier(dstDriver, dst.TableName), where))
+		r.Deletes++
+	}
+
+	for _, key := range d.Changed {
+		row, ok := rows[keyString(key)]
+		if !ok {
+			return nil, fmt.Errorf("row %s is not found in the source", formatKey(key))
+		}
+
+		stmt, err := updateStatement(dstDriver, dst.TableName, columns, keyColumns, key, row)
+		if err != nil {
+			return nil, err
+		}
+		r.Statements = append(r.Statements, stmt)
+		r.Updates++
+	}
+
+	for _, key := range d.Missing {
+		row, ok := rows[keyString(key)]
+		if !ok {
+			return nil, fmt.Errorf("row %s is not found in the source", formatKey(key))
+		}
+
+		stmt, err := insertStatement(dstDriver, dst.TableName, columns, row)
+		if err != nil {
+			return nil, err
+		}
+		r.Statements = append(r.Statements, stmt)
+		r.Inserts++
+	}
+
+	return r, nil
+}
+
+// rowsByKeys reads the rows having the given primary key values. The rows are
+// mapped by their keys and the values are in the order of the table columns.
+func (db *DB) rowsByKeys(ctx context.Context, table *TableInfo, keys [][]any) (map[string][]any, error) {
+	// we need to know where the primary keys are to map the rows
+	keyIndexes := make([]int, len(table.PrimaryKeys))
+	columns := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		columns[i] = quoteIdentifier(db.dbType, c.ColumnName)
+		for j, pk := range table.PrimaryKeys {
+			if pk == c.ColumnName {
+				keyIndexes[j] = i
+			}
+		}
+	}
+
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Question)
+	tableName := table.TableName
+	if db.dbType == DatabaseDriverPostgres {
+		builder = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+		currentSchema, err := db.currentSchema()
+		if err != nil {
+			return nil, err
+		}
+		tableName = strings.Join([]string{currentSchema, tableName}, ".")
+	}
+
+	rows := make(map[string][]any, len(keys))
+	for start := 0; start < len(keys); start += repairFetchSize {
+		end := start + repairFetchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var c sq.Or
+		for _, key := range keys[start:end] {
+			eq := sq.Eq{}
+			for i, pk := range table.PrimaryKeys {
+				eq[pk] = key[i]
+			}
+			c = append(c, eq)
+		}
+
+		query, args, err := builder.Select(columns...).From(tableName).Where(c).ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("could not build query: %w", err)
+		}
+
+		err = db.retry(ctx, table.TableName, query, func() error {
+			result, err := db.conn().QueryxContext(ctx, db.tagged(query), args...)
+			if err != nil {
+				return fmt.Errorf("could not select rows: %w", err)
+			}
+			defer result.Close()
+
+			for result.Next() {
+				values, err := result.SliceScan()
+				if err != nil {
+					return fmt.Errorf("could not scan row: %w", err)
+				}
+
+				key := make([]any, len(keyIndexes))
+				for i, idx := range keyIndexes {
+					key[i] = normalizeValue(values[idx])
+				}
+				rows[keyString(key)] = values
+			}
+
+			return result.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rows, nil
+}
+
+func insertStatement(driver, tableName string, columns []*ColumnInfo, row []any) (string, error) {
+	names := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		v, err := sqlLiteral(driver, c, row[i])
+		if err != nil {
+			return "", err
+		}
+		names[i] = quoteIdentifier(driver, c.ColumnName)
+		values[i] = v
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", quoteIdentifier(driver, tableName), strings.Join(names, ", "), strings.Join(values, ", ")), nil
+}
+
+func updateStatement(driver, tableName string, columns, keyColumns []*ColumnInfo, key, row []any) (string, error) {
+	isKey := make(map[*ColumnInfo]bool, len(keyColumns))
+	for _, c := range keyColumns {
+		isKey[c] = true
+	}
+
+	var set []string
+	for i, c := range columns {
+		if isKey[c] {
+			continue
+		}
+
+		v, err := sqlLiteral(driver, c, row[i])
+		if err != nil {
+			return "", err
+		}
+		set = append(set, fmt.Sprintf("%s = %s", quoteIdentifier(driver, c.ColumnName), v))
+	}
+
+	where, err := keyCondition(driver, keyColumns, key)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;", quoteIdentifier(driver, tableName), strings.Join(set, ", "), where), nil
+}
+
+func keyCondition(driver string, keyColumns []*ColumnInfo, key []any) (string, error) {
+	c := make([]string, len(keyColumns))
+	for i, kc := range keyColumns {
+		v, err := sqlLiteral(driver, kc, key[i])
+		if err != nil {
+			return "", err
+		}
+		c[i] = fmt.Sprintf("%s = %s", quoteIdentifier(driver, kc.ColumnName), v)
+	}
+
+	return strings.Join(c, " AND "), nil
+}
+
+// quoteIdentifier quotes a table or a column name for the given driver.
+func quoteIdentifier(driver, name string) string {
+	if driver == DatabaseDriverPostgres {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+var numericTypes = map[string]bool{
+	"tinyint":          true,
+	"smallint":         true,
+	"mediumint":        true,
+	"int":              true,
+	"integer":          true,
+	"bigint":           true,
+	"decimal":          true,
+	"numeric":          true,
+	"float":            true,
+	"double":           true,
+	"real":             true,
+	"double precision": true,
+}
+
+var binaryTypes = map[string]bool{
+	"bytea":      true,
+	"binary":     true,
+	"varbinary":  true,
+	"tinyblob":   true,
+	"blob":       true,
+	"mediumblob": true,
+	"longblob":   true,
+}
+
+// sqlLiteral formats a value read from either of the databases as a literal
+// for the given column of the target. The drivers return most of the values
+// as byte slices, hence the column type of the target decides on the format.
+func sqlLiteral(driver string, column *ColumnInfo, v any) (string, error) {
+	if v == nil {
+		return "NULL", nil
+	}
+
+	dataType := strings.ToLower(column.DataType)
+	switch {
+	case dataType == "boolean":
+		b, err := parseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("could not convert value of %q: %w", column.ColumnName, err)
+		}
+		return strings.ToUpper(strconv.FormatBool(b)), nil
+	case numericTypes[dataType]:
+		if b, ok := v.(bool); ok {
+			if b {
+				return "1", nil
+			}
+			return "0", nil
+		}
+		s := fmt.Sprint(normalizeValue(v))
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", fmt.Errorf("could not convert value of %q: %q is not a number", column.ColumnName, s)
+		}
+		return s, nil
+	case binaryTypes[dataType]:
+		var b []byte
+		switch t := v.(type) {
+		case []byte:
+			b = t
+		case string:
+			b = []byte(t)
+		default:
+			b = []byte(fmt.Sprint(t))
+		}
+		if driver == DatabaseDriverPostgres {
+			return fmt.Sprintf("decode('%s', 'hex')", hex.EncodeToString(b)), nil
+		}
+		return fmt.Sprintf("X'%s'", hex.EncodeToString(b)), nil
+	}
+
+	var s string
+	switch t := v.(type) {
+	case time.Time:
+		// the offset keeps the instant of the timestamptz columns regardless
+		// of the time zone of the session, postgres ignores it for the
+		// columns without a time zone. MySQL is given the time as it is.
+		if driver == DatabaseDriverPostgres {
+			s = t.Format("2006-01-02 15:04:05.999999-07:00")
+		} else {
+			s = t.Format("2006-01-02 15:04:05.999999")
+		}
+	case bool:
+		s = strconv.FormatBool(t)
+	default:
+		s = fmt.Sprint(normalizeValue(v))
+	}
+
+	return quoteString(driver, s), nil
+}
+
+// quoteString quotes a string literal, only the quotes are escaped. Postgres
+// is assumed to be running with standard_conforming_strings. MySQL treats
+// backslashes as escape characters unless NO_BACKSLASH_ESCAPES is set, so the
+// strings having a backslash or a NUL are written as hex literals instead,
+// they read the same in both modes.
+func quoteString(driver, s string) string {
+	if driver == DatabaseDriverMysql && strings.ContainsAny(s, "\\\x00") {
+		return "_utf8mb4 X'" + hex.EncodeToString([]byte(s)) + "'"
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func parseBool(v any) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case int64:
+		return t != 0, nil
+	}
+
+	s := fmt.Sprint(normalizeValue(v))
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n != 0, nil
+	}
+
+	return strconv.ParseBool(s)
+}
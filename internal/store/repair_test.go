@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLLiteral(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		driver   string
+		dataType string
+		value    any
+		expected string
+	}{
+		{"null", DatabaseDriverMysql, "varchar", nil, "NULL"},
+		{"mysql string", DatabaseDriverMysql, "varchar", []byte("it's a\ntest"), "'it''s a\ntest'"},
+		{"mysql backslash", DatabaseDriverMysql, "varchar", []byte(`it's a \ test`), "_utf8mb4 X'697427732061205c2074657374'"},
+		{"postgres string", DatabaseDriverPostgres, "character varying", `it's a \ test`, `'it''s a \ test'`},
+		{"mysql bool from postgres", DatabaseDriverMysql, "tinyint", true, "1"},
+		{"postgres bool from mysql", DatabaseDriverPostgres, "boolean", []byte("0"), "FALSE"},
+		{"number", DatabaseDriverPostgres, "bigint", []byte("-42"), "-42"},
+		{"mysql binary", DatabaseDriverMysql, "blob", []byte{0xde, 0xad}, "X'dead'"},
+		{"postgres binary", DatabaseDriverPostgres, "bytea", []byte{0xde, 0xad}, "decode('dead', 'hex')"},
+		{"time", DatabaseDriverMysql, "datetime", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), "'2023-01-02 03:04:05'"},
+		{"postgres time", DatabaseDriverPostgres, "timestamp with time zone", time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("", 2*3600)), "'2023-01-02 03:04:05+02:00'"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := sqlLiteral(tc.driver, &ColumnInfo{ColumnName: "c", DataType: tc.dataType}, tc.value)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, s)
+		})
+	}
+
+	_, err := sqlLiteral(DatabaseDriverMysql, &ColumnInfo{ColumnName: "c", DataType: "bigint"}, "1; DROP TABLE x")
+	require.Error(t, err)
+}
+
+func TestRepairStatements(t *testing.T) {
+	id := &ColumnInfo{ColumnName: "Id", DataType: "varchar"}
+	anotherID := &ColumnInfo{ColumnName: "AnotherId", DataType: "varchar"}
+	isActive := &ColumnInfo{ColumnName: "IsActive", DataType: "tinyint"}
+	columns := []*ColumnInfo{anotherID, id, isActive}
+	keys := []*ColumnInfo{id, anotherID}
+
+	stmt, err := insertStatement(DatabaseDriverMysql, "Table2", columns, []any{"b", "a", true})
+	require.NoError(t, err)
+	require.Equal(t, "INSERT INTO `Table2` (`AnotherId`, `Id`, `IsActive`) VALUES ('b', 'a', 1);", stmt)
+
+	stmt, err = updateStatement(DatabaseDriverMysql, "Table2", columns, keys, []any{"a", "b"}, []any{"b", "a", false})
+	require.NoError(t, err)
+	require.Equal(t, "UPDATE `Table2` SET `IsActive` = 0 WHERE `Id` = 'a' AND `AnotherId` = 'b';", stmt)
+
+	where, err := keyCondition(DatabaseDriverPostgres, keys, []any{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, `"Id" = 'a' AND "AnotherId" = 'b'`, where)
+}
+
+func TestRepair(t *testing.T) {
+	ec := rand.Intn(100) + 20
+	h := newTestHelper(t).SeedTableData(ec)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("DELETE FROM Table2 WHERE Id IN (SELECT Id FROM Table2 LIMIT 1)")
+	require.NoError(t, err)
+	_, err = pgdb.sqlDB.Exec("UPDATE Table1 SET Name = 'changed' WHERE Id IN (SELECT Id FROM Table1 LIMIT 1)")
+	require.NoError(t, err)
+
+	repairs, _, err := Repair(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, repairs, 2)
+
+	for _, r := range repairs {
+		for _, stmt := range r.Statements {
+			_, err = pgdb.sqlDB.Exec(stmt)
+			require.NoError(t, err)
+		}
+	}
+
+	diffs, _, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestRepairUniqueCollision(t *testing.T) {
+	h := newTestHelper(t).SeedTableData(20)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	// the extra row holds the unique name of the missing one
+	_, err := pgdb.sqlDB.Exec("UPDATE Table1 SET Id = $1 WHERE Id IN (SELECT Id FROM Table1 LIMIT 1)", newId())
+	require.NoError(t, err)
+
+	repairs, _, err := Repair(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, repairs, 1)
+	require.Equal(t, 1, repairs[0].Deletes)
+	require.Equal(t, 1, repairs[0].Inserts)
+	require.True(t, strings.HasPrefix(repairs[0].Statements[0], "DELETE"))
+
+	for _, stmt := range repairs[0].Statements {
+		_, err = pgdb.sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	diffs, _, err := Diff(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{
+		PageSize: 20,
+	})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestRepairTimestamptz(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("CREATE TABLE Table5 (Id integer PRIMARY KEY, At timestamptz NOT NULL)")
+	require.NoError(t, err)
+
+	at := time.Date(2023, 1, 2, 3, 4, 5, 123456000, time.FixedZone("", 2*3600))
+	stmt, err := insertStatement(DatabaseDriverPostgres, "Table5", []*ColumnInfo{
+		{ColumnName: "Id", DataType: "integer"},
+		{ColumnName: "At", DataType: "timestamp with time zone"},
+	}, []any{int64(1), at})
+	require.NoError(t, err)
+
+	// the statement keeps the instant in a session of another time zone
+	tx, err := pgdb.sqlDB.Beginx()
+	require.NoError(t, err)
+	_, err = tx.Exec("SET LOCAL TIME ZONE 'America/New_York'")
+	require.NoError(t, err)
+	_, err = tx.Exec(stmt)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	var got time.Time
+	err = pgdb.sqlDB.Get(&got, "SELECT At FROM Table5 WHERE Id = 1")
+	require.NoError(t, err)
+	require.True(t, at.Equal(got), "expected %s, got %s", at, got)
+}
+
+func TestRepairBackslashes(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.Teardown()
+
+	mysqldb, ok := h.dbInstances["mysql"]
+	require.True(t, ok)
+
+	value := `C:\new\'path'`
+	stmt, err := insertStatement(DatabaseDriverMysql, "Table1", []*ColumnInfo{
+		{ColumnName: "Id", DataType: "varchar"},
+		{ColumnName: "CreateAt", DataType: "bigint"},
+		{ColumnName: "Name", DataType: "varchar"},
+		{ColumnName: "Description", DataType: "text"},
+	}, []any{"a", int64(1), "a", value})
+	require.NoError(t, err)
+
+	// the statement reads the same whether the backslashes are escapes or not
+	for i, mode := range []string{"", "NO_BACKSLASH_ESCAPES"} {
+		conn, err := mysqldb.sqlDB.Connx(context.Background())
+		require.NoError(t, err)
+
+		_, err = conn.ExecContext(context.Background(), "SET SESSION sql_mode = ?", mode)
+		require.NoError(t, err)
+		_, err = conn.ExecContext(context.Background(), strings.Replace(stmt, "'a'", fmt.Sprintf("'%d'", i), 2))
+		require.NoError(t, err)
+
+		var got string
+		err = conn.GetContext(context.Background(), &got, "SELECT Description FROM Table1 WHERE Id = ?", fmt.Sprint(i))
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+		conn.Close()
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"time"
+)
+
+// TableStatus is the outcome of the comparison of a single table.
+type TableStatus string
+
+const (
+	// TableStatusMatch means the contents of the table are the same.
+	TableStatusMatch TableStatus = "match"
+	// TableStatusCountMismatch means the row counts of the table differ.
+	TableStatusCountMismatch TableStatus = "count_mismatch"
+	// TableStatusChecksumMismatch means the row counts are the same but at
+	// least one page checksum differs.
+	TableStatusChecksumMismatch TableStatus = "checksum_mismatch"
+	// TableStatusSchemaMismatch means the tables have different columns or
+	// primary keys, hence their contents are not compared.
+	TableStatusSchemaMismatch TableStatus = "schema_mismatch"
+	// TableStatusMissingInTarget means the table exists in the source only.
+	TableStatusMissingInTarget TableStatus = "missing_in_target"
+	// TableStatusExtraInTarget means the table exists in the target only.
+	TableStatusExtraInTarget TableStatus = "extra_in_target"
+	// TableStatusError means the table could not be compared.
+	TableStatusError TableStatus = "error"
+)
+
+// TableResult is the result of the comparison of a single table.
+type TableResult struct {
+	TableName  string
+	Status     TableStatus
+	SourceRows int
+	TargetRows int
+	// PagesChecked is the number of the compared pages, or buckets if the
+	// table is partitioned into buckets.
+	PagesChecked int
+	// FirstMismatch is the key range of the first page whose checksum differs.
+	FirstMismatch *KeyRange
+	// MismatchedRanges are the differing key ranges found by the bisection.
+	MismatchedRanges []KeyRange
+	// MismatchedBuckets are the buckets whose checksums differ.
+	MismatchedBuckets []int
+	// MismatchedSplits are the key ranges the table was split into that
+	// have at least one mismatching page.
+	MismatchedSplits []KeyRange
+	Elapsed          time.Duration
+	Warnings         []string
+	// SourceSnapshot and TargetSnapshot are the positions of the snapshots
+	// the table was read from, if any.
+	SourceSnapshot *SnapshotPosition
+	TargetSnapshot *SnapshotPosition
+	// Reverification is the outcome of re-checking the mismatches, it's nil
+	// if there was nothing to re-check.
+	Reverification *Reverification
+	// Retries is the number of the queries of the table retried after a
+	// transient error.
+	Retries int
+	// Error is not persisted into the checkpoints, the failed tables are
+	// compared again once resumed.
+	Error error `json:"-"`
+}
+
+// Equal returns true if the contents of the table are the same.
+func (r *TableResult) Equal() bool {
+	return r.Status == TableStatusMatch
+}
+
+// CompareResult is the result of a database comparison. Tables are sorted by
+// their names.
+type CompareResult struct {
+	Source DatabaseInfo
+	Target DatabaseInfo
+	Tables []*TableResult
+	// Excluded are the source tables left out by the exclude patterns.
+	Excluded []string
+	Elapsed  time.Duration
+	Warnings []string
+	// SourceSnapshot and TargetSnapshot are the positions of the snapshots
+	// all tables were read from, if any.
+	SourceSnapshot *SnapshotPosition
+	TargetSnapshot *SnapshotPosition
+	// Incomplete means the comparison was cancelled, the tables that were
+	// not completed by then are left out.
+	Incomplete bool
+
+	allowMissingTables bool
+	failOnExtraTables  bool
+}
+
+// Mismatches returns the results of the tables that are not equal. The
+// missing and extra tables are left out unless they are set to fail the run
+// by the CompareOptions.
+func (r *CompareResult) Mismatches() []*TableResult {
+	var mismatches []*TableResult
+	for _, t := range r.Tables {
+		switch {
+		case t.Equal():
+		case t.Status == TableStatusMissingInTarget && r.allowMissingTables:
+		case t.Status == TableStatusExtraInTarget && !r.failOnExtraTables:
+		default:
+			mismatches = append(mismatches, t)
+		}
+	}
+
+	return mismatches
+}
+
+// Errors returns the results of the tables that could not be compared, they
+// are among the Mismatches as well.
+func (r *CompareResult) Errors() []*TableResult {
+	var errs []*TableResult
+	for _, t := range r.Tables {
+		if t.Status == TableStatusError {
+			errs = append(errs, t)
+		}
+	}
+
+	return errs
+}
+
+// Equal returns true if none of the tables fail the comparison. An incomplete
+// comparison is never equal.
+func (r *CompareResult) Equal() bool {
+	return !r.Incomplete && len(r.Mismatches()) == 0
+}
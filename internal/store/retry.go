@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// the mysql errors worth retrying: deadlocks and lock wait timeouts. The
+// queries interrupted by the max_execution_time are not retried, the timeout
+// is there to protect the server.
+var mysqlRetryableErrors = map[uint16]bool{
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+}
+
+// the postgres errors worth retrying, the connection exceptions of the class
+// 08 are retried as well. The queries canceled by the statement_timeout are
+// not.
+var pgRetryableErrors = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"57P01": true, // admin_shutdown
+}
+
+// retryPolicy is the way the failed queries are retried, the delay doubles
+// after each attempt.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// retryCounts counts the retried queries per table, it's shared by a DB and
+// its snapshots.
+type retryCounts struct {
+	mu     sync.Mutex
+	tables map[string]int
+}
+
+// retryable returns true if the error is likely to be transient, such as a
+// deadlock, a lock wait timeout or a dropped connection. The canceled queries
+// are never retried.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlRetryableErrors[mysqlErr.Number]
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pgRetryableErrors[pqErr.Code] || strings.HasPrefix(string(pqErr.Code), "08")
+	}
+
+	var netErr net.Error
+	return errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// retry runs the query of the table until it succeeds, fails with an error
+// that is not transient or runs out of the retries. fn must be safe to run
+// again. The retries are counted per table, see retriesOf. The final error is
+// returned as a QueryError.
+//
+// The queries of a snapshot are never retried: a failed statement aborts the
+// transaction on postgres and a deadlock rolls it back on mysql, so a retry
+// would either fail again or read outside of the snapshot.
+func (db *DB) retry(ctx context.Context, table, query string, fn func() error) error {
+	retries := db.retries.retries
+	if db.snapshotConn != nil {
+		retries = 0
+	}
+
+	delay := db.retries.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= retries || ctx.Err() != nil || !retryable(err) {
+			return &QueryError{Dialect: db.dbType, Query: query, Err: err}
+		}
+
+		db.retried.mu.Lock()
+		db.retried.tables[strings.ToLower(table)]++
+		db.retried.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return &QueryError{Dialect: db.dbType, Query: query, Err: err}
+		}
+		delay *= 2
+	}
+}
+
+// retriesOf returns the number of the retried queries of the table.
+func (db *DB) retriesOf(table string) int {
+	db.retried.mu.Lock()
+	defer db.retried.mu.Unlock()
+
+	return db.retried.tables[strings.ToLower(table)]
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryable(t *testing.T) {
+	require.True(t, retryable(&mysql.MySQLError{Number: 1213}))
+	require.True(t, retryable(fmt.Errorf("could not select checksum: %w", &mysql.MySQLError{Number: 1205})))
+	require.True(t, retryable(mysql.ErrInvalidConn))
+	require.True(t, retryable(&pq.Error{Code: "40P01"}))
+	require.True(t, retryable(&pq.Error{Code: "08006"}))
+
+	require.False(t, retryable(&mysql.MySQLError{Number: 1146}))
+	require.False(t, retryable(&mysql.MySQLError{Number: 3024}))
+	require.False(t, retryable(&pq.Error{Code: "57014"}))
+	require.False(t, retryable(fmt.Errorf("could not select checksum: %w", context.Canceled)))
+	require.False(t, retryable(context.DeadlineExceeded))
+	require.False(t, retryable(&pq.Error{Code: "42P01"}))
+	require.False(t, retryable(errors.New("could not parse template")))
+}
+
+func TestRetry(t *testing.T) {
+	db := &DB{
+		dbType:  DatabaseDriverMysql,
+		retries: retryPolicy{retries: 2, backoff: time.Millisecond},
+		retried: &retryCounts{tables: make(map[string]int)},
+	}
+
+	attempts := 0
+	err := db.retry(context.Background(), "Table1", "SELECT 1", func() error {
+		attempts++
+		if attempts < 3 {
+			return &mysql.MySQLError{Number: 1213}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 2, db.retriesOf("table1"))
+
+	attempts = 0
+	err = db.retry(context.Background(), "Table2", "SELECT 1", func() error {
+		attempts++
+		return &mysql.MySQLError{Number: 1213}
+	})
+	var queryErr *QueryError
+	require.ErrorAs(t, err, &queryErr)
+	require.Equal(t, "SELECT 1", queryErr.Query)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = db.retry(context.Background(), "Table3", "SELECT 1", func() error {
+		attempts++
+		return &mysql.MySQLError{Number: 1146}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+	require.Zero(t, db.retriesOf("Table3"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = db.retry(ctx, "Table5", "SELECT 1", func() error {
+		attempts++
+		cancel()
+		return mysql.ErrInvalidConn
+	})
+	require.ErrorIs(t, err, mysql.ErrInvalidConn)
+	require.Equal(t, 1, attempts)
+	require.Zero(t, db.retriesOf("Table5"))
+
+	snapshot := &DB{
+		dbType:       DatabaseDriverMysql,
+		retries:      db.retries,
+		retried:      db.retried,
+		snapshotConn: &sqlx.Conn{},
+	}
+	attempts = 0
+	err = snapshot.retry(context.Background(), "Table4", "SELECT 1", func() error {
+		attempts++
+		return &mysql.MySQLError{Number: 1213}
+	})
+	require.ErrorAs(t, err, &queryErr)
+	require.Equal(t, 1, attempts)
+	require.Zero(t, db.retriesOf("Table4"))
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Reverification is the outcome of re-checking the mismatches of a table. The
+// writes in flight on a live database cause mismatches that go away once they
+// are replicated, only the persistent ones are reported as differences.
+type Reverification struct {
+	// Retries is the highest number of re-checks made for a mismatch.
+	Retries int
+	// Persistent means at least one of the mismatches never went away.
+	Persistent bool
+	// Converged are the key ranges of the pages that stopped mismatching.
+	Converged []KeyRange
+}
+
+// String returns the label of the outcome.
+func (v *Reverification) String() string {
+	switch {
+	case v == nil:
+		return ""
+	case v.Persistent:
+		return "persistent"
+	default:
+		return fmt.Sprintf("converged after %d retries", v.Retries)
+	}
+}
+
+// add records the outcome of re-checking a single mismatch, the page is nil
+// for the mismatches not bound to a key range. A nil Reverification is
+// created.
+func (v *Reverification) add(retries int, converged bool, page *KeyRange) *Reverification {
+	if v == nil {
+		v = &Reverification{}
+	}
+
+	if retries > v.Retries {
+		v.Retries = retries
+	}
+	if !converged {
+		v.Persistent = true
+	} else if page != nil {
+		v.Converged = append(v.Converged, *page)
+	}
+
+	return v
+}
+
+// merge combines the outcomes of the splits of a table.
+func (v *Reverification) merge(other *Reverification) *Reverification {
+	switch {
+	case other == nil:
+		return v
+	case v == nil:
+		c := *other
+		return &c
+	}
+
+	if other.Retries > v.Retries {
+		v.Retries = other.Retries
+	}
+	v.Persistent = v.Persistent || other.Persistent
+	v.Converged = append(v.Converged, other.Converged...)
+
+	return v
+}
+
+// reverify re-checks a mismatch after the delay until it goes away or the
+// attempts run out. It returns the number of the re-checks made and whether
+// the mismatch went away.
+func reverify(ctx context.Context, opts CompareOptions, check func() (bool, error)) (int, bool, error) {
+	for i := 1; i <= opts.Reverify; i++ {
+		select {
+		case <-time.After(opts.ReverifyDelay):
+		case <-ctx.Done():
+			return i - 1, false, ctx.Err()
+		}
+
+		equal, err := check()
+		if err != nil || equal {
+			return i, equal, err
+		}
+	}
+
+	return opts.Reverify, false, nil
+}
+
+// checksumsEqual checksums the page on both sides again, a zero page is the
+// whole table.
+func checksumsEqual(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, page cursorData) (bool, error) {
+	var srcChecksum, dstChecksum string
+	err := concurrently(func() error {
+		var err error
+		srcChecksum, _, err = srcdb.checksum(ctx, src, page)
+		if err != nil {
+			return fmt.Errorf("could not compute src checksum: %w", err)
+		}
+		return nil
+	}, func() error {
+		var err error
+		dstChecksum, _, err = dstdb.checksum(ctx, dst, page)
+		if err != nil {
+			return fmt.Errorf("could not compute dst checksum: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return srcChecksum == dstChecksum, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverification(t *testing.T) {
+	var v *Reverification
+	require.Equal(t, "", v.String())
+
+	v = v.add(2, true, &KeyRange{From: []any{"1"}, To: []any{"5"}})
+	require.Equal(t, "converged after 2 retries", v.String())
+	require.Len(t, v.Converged, 1)
+
+	other := (*Reverification)(nil).add(3, false, &KeyRange{From: []any{"5"}, To: []any{"9"}})
+	v = v.merge(other)
+	require.Equal(t, "persistent", v.String())
+	require.Equal(t, 3, v.Retries)
+	require.Len(t, v.Converged, 1)
+}
+
+func TestReverify(t *testing.T) {
+	opts := CompareOptions{Reverify: 3, ReverifyDelay: time.Millisecond}
+
+	checks := 0
+	retries, converged, err := reverify(context.Background(), opts, func() (bool, error) {
+		checks++
+		return checks == 2, nil
+	})
+	require.NoError(t, err)
+	require.True(t, converged)
+	require.Equal(t, 2, retries)
+
+	retries, converged, err = reverify(context.Background(), opts, func() (bool, error) {
+		return false, nil
+	})
+	require.NoError(t, err)
+	require.False(t, converged)
+	require.Equal(t, 3, retries)
+
+	require.Equal(t, []int{3, 7}, intersectBuckets([]int{1, 3, 7}, []int{2, 3, 7, 9}))
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SchemaDiffKind is the kind of a schema difference.
+type SchemaDiffKind string
+
+const (
+	SchemaDiffTableMissing   SchemaDiffKind = "table_missing"
+	SchemaDiffTableExtra     SchemaDiffKind = "table_extra"
+	SchemaDiffColumnMissing  SchemaDiffKind = "column_missing"
+	SchemaDiffColumnExtra    SchemaDiffKind = "column_extra"
+	SchemaDiffColumnType     SchemaDiffKind = "column_type"
+	SchemaDiffColumnNullable SchemaDiffKind = "column_nullable"
+	SchemaDiffColumnDefault  SchemaDiffKind = "column_default"
+	SchemaDiffPrimaryKey     SchemaDiffKind = "primary_key"
+	SchemaDiffUniqueMissing  SchemaDiffKind = "unique_missing"
+	SchemaDiffUniqueExtra    SchemaDiffKind = "unique_extra"
+	SchemaDiffIndexMissing   SchemaDiffKind = "index_missing"
+	SchemaDiffIndexExtra     SchemaDiffKind = "index_extra"
+)
+
+// SchemaDifference is a single difference between the source and the target
+// schemas. Missing means it exists in the source only, extra means it exists
+// in the target only.
+type SchemaDifference struct {
+	Kind   SchemaDiffKind
+	Table  string
+	Object string
+	Source string
+	Target string
+}
+
+func (d SchemaDifference) String() string {
+	name := d.Table
+	if d.Object != "" {
+		name += "." + d.Object
+	}
+
+	if d.Source == "" && d.Target == "" {
+		return fmt.Sprintf("%s: %s", d.Kind, name)
+	}
+
+	return fmt.Sprintf("%s: %s (source: %s, target: %s)", d.Kind, name, d.Source, d.Target)
+}
+
+// normalizedTypes maps the data types of both dialects into a common name.
+var normalizedTypes = map[string]string{
+	"character varying":           "varchar",
+	"character":                   "char",
+	"tinytext":                    "text",
+	"mediumtext":                  "text",
+	"longtext":                    "text",
+	"int":                         "integer",
+	"mediumint":                   "integer",
+	"decimal":                     "numeric",
+	"float":                       "real",
+	"double":                      "double precision",
+	"bool":                        "boolean",
+	"datetime":                    "timestamp",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+	"time without time zone":      "time",
+	"jsonb":                       "json",
+	"tinyblob":                    "bytea",
+	"blob":                        "bytea",
+	"mediumblob":                  "bytea",
+	"longblob":                    "bytea",
+	"binary":                      "bytea",
+	"varbinary":                   "bytea",
+	"enum":                        "enum",
+	"user-defined":                "enum",
+}
+
+// equivalentTypes are the normalized types that hold the same values across
+// the dialects, e.g. MySQL doesn't have a boolean type.
+var equivalentTypes = map[[2]string]bool{
+	{"boolean", "tinyint"}:  true,
+	{"smallint", "tinyint"}: true,
+	{"text", "varchar"}:     true,
+	{"enum", "varchar"}:     true,
+}
+
+func normalizeDataType(dataType string) string {
+	t := strings.ToLower(strings.TrimSpace(dataType))
+	if n, ok := normalizedTypes[t]; ok {
+		return n
+	}
+
+	return t
+}
+
+// sameDataType returns true if the data types are the same or equivalent
+// once normalized.
+func sameDataType(a, b string) bool {
+	na, nb := normalizeDataType(a), normalizeDataType(b)
+	if na == nb {
+		return true
+	}
+
+	if na > nb {
+		na, nb = nb, na
+	}
+
+	return equivalentTypes[[2]string{na, nb}]
+}
+
+var defaultCast = regexp.MustCompile(`::[a-z ]+(\[\])?$`)
+
+// normalizeDefault removes the dialect specific decorations from a column
+// default, such as the casts and the quotes postgres adds.
+func normalizeDefault(def *string) string {
+	if def == nil {
+		return ""
+	}
+
+	d := strings.TrimSpace(*def)
+	d = defaultCast.ReplaceAllString(d, "")
+	d = strings.Trim(strings.TrimSuffix(strings.TrimPrefix(d, "("), ")"), "'")
+	if strings.EqualFold(d, "NULL") {
+		return ""
+	}
+
+	return d
+}
+
+// CompareSchema compares the tables, columns, primary keys and indexes of the
+// source and the target databases. The data types are normalized so that the
+// equivalent types of MySQL and Postgres are not reported.
+func CompareSchema(srcDSN, dstDSN string, opts CompareOptions) ([]SchemaDifference, error) {
+	srcdb, dstdb, err := openDatabases(srcDSN, dstDSN, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer srcdb.sqlDB.Close()
+	defer dstdb.sqlDB.Close()
+
+	srcTables, dstTables, _, err := listTables(srcdb, dstdb, opts.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []SchemaDifference
+	for _, k := range sortedTableNames(srcTables) {
+		v := srcTables[k]
+		v2, ok := dstTables[k]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffTableMissing, Table: v.TableName})
+			continue
+		}
+
+		diffs = append(diffs, compareColumns(v, v2)...)
+		diffs = append(diffs, comparePrimaryKeys(v, v2)...)
+
+		srcIndexes, err := srcdb.indexes(v.TableName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list src indexes of %q: %w", v.TableName, err)
+		}
+		dstIndexes, err := dstdb.indexes(v2.TableName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list dst indexes of %q: %w", v2.TableName, err)
+		}
+		diffs = append(diffs, compareIndexes(v.TableName, srcIndexes, dstIndexes)...)
+	}
+
+	for _, k := range sortedTableNames(dstTables) {
+		if _, ok := srcTables[k]; !ok && !excluded(k, opts.ExcludePatterns) {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffTableExtra, Table: dstTables[k].TableName})
+		}
+	}
+
+	return diffs, nil
+}
+
+// compareColumns compares the columns of the tables by their names, the case
+// of the names is ignored.
+func compareColumns(src, dst *TableInfo) []SchemaDifference {
+	var diffs []SchemaDifference
+
+	dstColumns := make(map[string]*ColumnInfo, len(dst.Columns))
+	for _, c := range dst.Columns {
+		dstColumns[strings.ToLower(c.ColumnName)] = c
+	}
+
+	srcColumns := make(map[string]*ColumnInfo, len(src.Columns))
+	for _, c := range src.Columns {
+		name := strings.ToLower(c.ColumnName)
+		srcColumns[name] = c
+
+		c2, ok := dstColumns[name]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffColumnMissing, Table: src.TableName, Object: c.ColumnName})
+			continue
+		}
+
+		if !sameDataType(c.DataType, c2.DataType) {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffColumnType, Table: src.TableName, Object: c.ColumnName, Source: c.DataType, Target: c2.DataType})
+		}
+
+		if c.Nullable() != c2.Nullable() {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffColumnNullable, Table: src.TableName, Object: c.ColumnName, Source: c.IsNullable, Target: c2.IsNullable})
+		}
+
+		if d1, d2 := normalizeDefault(c.Default), normalizeDefault(c2.Default); d1 != d2 {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffColumnDefault, Table: src.TableName, Object: c.ColumnName, Source: d1, Target: d2})
+		}
+	}
+
+	for _, c := range dst.Columns {
+		if _, ok := srcColumns[strings.ToLower(c.ColumnName)]; !ok {
+			diffs = append(diffs, SchemaDifference{Kind: SchemaDiffColumnExtra, Table: src.TableName, Object: c.ColumnName})
+		}
+	}
+
+	return diffs
+}
+
+// comparePrimaryKeys compares the primary key columns in order.
+func comparePrimaryKeys(src, dst *TableInfo) []SchemaDifference {
+	pk1 := strings.ToLower(strings.Join(src.PrimaryKeys, ","))
+	pk2 := strings.ToLower(strings.Join(dst.PrimaryKeys, ","))
+	if pk1 == pk2 {
+		return nil
+	}
+
+	return []SchemaDifference{{
+		Kind:   SchemaDiffPrimaryKey,
+		Table:  src.TableName,
+		Source: strings.Join(src.PrimaryKeys, ","),
+		Target: strings.Join(dst.PrimaryKeys, ","),
+	}}
+}
+
+// compareIndexes compares the indexes by their columns and uniqueness since the
+// index names are generated differently by the dialects. The primary keys are
+// compared separately.
+func compareIndexes(table string, src, dst []*IndexInfo) []SchemaDifference {
+	var diffs []SchemaDifference
+
+	signature := func(idx *IndexInfo) string {
+		return fmt.Sprintf("%t:%s", idx.Unique, strings.ToLower(strings.Join(idx.Columns, ",")))
+	}
+
+	dstIndexes := make(map[string]*IndexInfo, len(dst))
+	for _, idx := range dst {
+		dstIndexes[signature(idx)] = idx
+	}
+
+	srcIndexes := make(map[string]*IndexInfo, len(src))
+	for _, idx := range src {
+		if idx.Primary {
+			continue
+		}
+		srcIndexes[signature(idx)] = idx
+
+		if _, ok := dstIndexes[signature(idx)]; !ok {
+			kind := SchemaDiffIndexMissing
+			if idx.Unique {
+				kind = SchemaDiffUniqueMissing
+			}
+			diffs = append(diffs, SchemaDifference{Kind: kind, Table: table, Object: idx.IndexName, Source: strings.Join(idx.Columns, ",")})
+		}
+	}
+
+	for _, idx := range dst {
+		if idx.Primary {
+			continue
+		}
+
+		if _, ok := srcIndexes[signature(idx)]; !ok {
+			kind := SchemaDiffIndexExtra
+			if idx.Unique {
+				kind = SchemaDiffUniqueExtra
+			}
+			diffs = append(diffs, SchemaDifference{Kind: kind, Table: table, Object: idx.IndexName, Target: strings.Join(idx.Columns, ",")})
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSameDataType(t *testing.T) {
+	require.True(t, sameDataType("varchar", "character varying"))
+	require.True(t, sameDataType("tinyint", "boolean"))
+	require.True(t, sameDataType("json", "jsonb"))
+	require.True(t, sameDataType("longtext", "text"))
+	require.True(t, sameDataType("datetime", "timestamp without time zone"))
+	require.False(t, sameDataType("bigint", "integer"))
+	require.False(t, sameDataType("timestamp", "timestamp with time zone"))
+}
+
+func TestNormalizeDefault(t *testing.T) {
+	def := func(s string) *string { return &s }
+
+	require.Equal(t, "", normalizeDefault(nil))
+	require.Equal(t, "", normalizeDefault(def("NULL::character varying")))
+	require.Equal(t, "abc", normalizeDefault(def("'abc'::character varying")))
+	require.Equal(t, "abc", normalizeDefault(def("abc")))
+	require.Equal(t, "0", normalizeDefault(def("0")))
+}
+
+func TestCompareColumnsAndIndexes(t *testing.T) {
+	src := &TableInfo{
+		TableName:   "Table1",
+		PrimaryKeys: []string{"Id"},
+		Columns: []*ColumnInfo{
+			{ColumnName: "Id", DataType: "varchar", IsNullable: "NO"},
+			{ColumnName: "Name", DataType: "varchar", IsNullable: "YES"},
+			{ColumnName: "Removed", DataType: "int", IsNullable: "YES"},
+		},
+	}
+	dst := &TableInfo{
+		TableName:   "table1",
+		PrimaryKeys: []string{"id"},
+		Columns: []*ColumnInfo{
+			{ColumnName: "id", DataType: "character varying", IsNullable: "NO"},
+			{ColumnName: "name", DataType: "bigint", IsNullable: "NO"},
+			{ColumnName: "added", DataType: "text", IsNullable: "YES"},
+		},
+	}
+
+	diffs := compareColumns(src, dst)
+	kinds := make([]SchemaDiffKind, len(diffs))
+	for i := range diffs {
+		kinds[i] = diffs[i].Kind
+	}
+	require.Equal(t, []SchemaDiffKind{SchemaDiffColumnType, SchemaDiffColumnNullable, SchemaDiffColumnMissing, SchemaDiffColumnExtra}, kinds)
+	require.Empty(t, comparePrimaryKeys(src, dst))
+
+	diffs = compareIndexes("Table1", []*IndexInfo{
+		{IndexName: "PRIMARY", Columns: []string{"Id"}, Unique: true, Primary: true},
+		{IndexName: "Name", Columns: []string{"Name"}, Unique: true},
+		{IndexName: "idx_createat", Columns: []string{"CreateAt"}},
+	}, []*IndexInfo{
+		{IndexName: "table1_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+		{IndexName: "table1_name_key", Columns: []string{"name"}, Unique: true},
+	})
+	require.Len(t, diffs, 1)
+	require.Equal(t, SchemaDiffIndexMissing, diffs[0].Kind)
+}
+
+func TestCompareSchema(t *testing.T) {
+	h := newTestHelper(t)
+	defer h.Teardown()
+
+	diffs, err := CompareSchema(mysqlTestDSN, pgsqlTestDSN, CompareOptions{})
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err = pgdb.sqlDB.Exec("ALTER TABLE Table1 ADD COLUMN Extra VARCHAR(10)")
+	require.NoError(t, err)
+
+	diffs, err = CompareSchema(mysqlTestDSN, pgsqlTestDSN, CompareOptions{})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	require.Equal(t, SchemaDiffColumnExtra, diffs[0].Kind)
+}
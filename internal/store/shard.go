@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard is a deterministic subset of the tables compared by one of several
+// processes. The Index is one-based and never greater than the Count.
+type Shard struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+}
+
+// ParseShard parses a shard in the form of "i/n".
+func ParseShard(s string) (*Shard, error) {
+	i, n, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid shard %q, it should be in the form of i/n", s)
+	}
+
+	index, err := strconv.Atoi(i)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard index %q: %w", i, err)
+	}
+
+	count, err := strconv.Atoi(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard count %q: %w", n, err)
+	}
+
+	shard := &Shard{Index: index, Count: count}
+	if err := shard.validate(); err != nil {
+		return nil, err
+	}
+
+	return shard, nil
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+func (s *Shard) validate() error {
+	if s.Count < 1 {
+		return fmt.Errorf("shard count could not be less than 1 (one), current value is: %d", s.Count)
+	}
+
+	if s.Index < 1 || s.Index > s.Count {
+		return fmt.Errorf("shard index should be between 1 and %d, current value is: %d", s.Count, s.Index)
+	}
+
+	return nil
+}
+
+// owns returns true if the given split of the table belongs to the shard. The
+// tables are distributed by the hash of their names, the splits of a table
+// are distributed round robin starting from the shard owning the table. A nil
+// shard owns everything.
+func (s *Shard) owns(tableName string, split int) bool {
+	if s == nil {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(tableName)))
+
+	return (int(h.Sum32()%uint32(s.Count))+split)%s.Count == s.Index-1
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShard(t *testing.T) {
+	shard, err := ParseShard("2/4")
+	require.NoError(t, err)
+	require.Equal(t, &Shard{Index: 2, Count: 4}, shard)
+	require.Equal(t, "2/4", shard.String())
+
+	for _, s := range []string{"2", "a/4", "2/b", "0/4", "5/4", "1/0"} {
+		_, err := ParseShard(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestShardOwns(t *testing.T) {
+	shards := []*Shard{{Index: 1, Count: 3}, {Index: 2, Count: 3}, {Index: 3, Count: 3}}
+
+	for i := 0; i < 50; i++ {
+		table := fmt.Sprintf("Table%d", i)
+		for split := 0; split < 5; split++ {
+			owners := 0
+			for _, s := range shards {
+				if s.owns(table, split) {
+					owners++
+				}
+			}
+			require.Equal(t, 1, owners, "%s split %d", table, split)
+		}
+
+		// the name is matched case-insensitively
+		require.Equal(t, shards[0].owns(table, 0), shards[0].owns(fmt.Sprintf("table%d", i), 0))
+	}
+
+	var nilShard *Shard
+	require.True(t, nilShard.owns("Table1", 3))
+}
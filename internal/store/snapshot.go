@@ -0,0 +1,266 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SnapshotScope is the scope of the consistent snapshots the tables are read
+// from.
+type SnapshotScope string
+
+const (
+	// SnapshotNone reads each page in its own statement.
+	SnapshotNone SnapshotScope = ""
+	// SnapshotTable reads all pages of a table from a single snapshot on
+	// each side.
+	SnapshotTable SnapshotScope = "table"
+	// SnapshotRun reads all tables from a single snapshot on each side.
+	SnapshotRun SnapshotScope = "run"
+)
+
+// mysqlErrParse is the error of an unknown statement, SHOW MASTER STATUS is
+// removed in favor of SHOW BINARY LOG STATUS.
+const mysqlErrParse = 1064
+
+// SnapshotPosition is the position of the database at which a snapshot was
+// taken. For mysql it's the binary log position and the executed GTID set,
+// for postgres the WAL location.
+type SnapshotPosition struct {
+	BinlogFile     string `json:"binlog_file,omitempty"`
+	BinlogPosition uint64 `json:"binlog_position,omitempty"`
+	GTIDSet        string `json:"gtid_set,omitempty"`
+	LSN            string `json:"lsn,omitempty"`
+	// Approximate means the position is read after the snapshot is taken,
+	// the writes committed in between are included in the position but not
+	// in the snapshot.
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// String returns the position in the notation of the database.
+func (p *SnapshotPosition) String() string {
+	var s string
+	switch {
+	case p == nil:
+		return ""
+	case p.LSN != "":
+		s = p.LSN
+	case p.GTIDSet != "":
+		s = p.GTIDSet
+	case p.BinlogFile != "":
+		s = fmt.Sprintf("%s:%d", p.BinlogFile, p.BinlogPosition)
+	default:
+		return ""
+	}
+
+	if p.Approximate {
+		s += " (approximate)"
+	}
+
+	return s
+}
+
+// snapshot starts a read-only REPEATABLE READ transaction on a dedicated
+// connection and returns a DB reading the data through it, along with the
+// position the snapshot was taken at. The position is unknown if the server
+// doesn't keep a binary log or the user lacks the privileges, in which case a
+// nil position is returned. The snapshot must be released once done.
+func (db *DB) snapshot(ctx context.Context) (*DB, *SnapshotPosition, error) {
+	// the snapshots share the schema of the connection pool
+	schema := ""
+	if db.dbType == DatabaseDriverPostgres {
+		var err error
+		schema, err = db.currentSchema()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, err := db.sqlDB.Connx(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get a connection: %w", err)
+	}
+
+	var statements []string
+	switch db.dbType {
+	case DatabaseDriverMysql:
+		statements = []string{
+			"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+		}
+	case DatabaseDriverPostgres:
+		statements = []string{"BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"}
+	default:
+		conn.Close()
+		return nil, nil, fmt.Errorf("unrecognized database driver: %s", db.dbType)
+	}
+
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("could not start snapshot: %w", err)
+		}
+	}
+
+	s := &DB{
+		sqlDB:          db.sqlDB,
+		dbType:         db.dbType,
+		info:           db.info,
+		binaryKeyOrder: db.binaryKeyOrder,
+		tag:            db.tag,
+		retries:        db.retries,
+		retried:        db.retried,
+		schema:         schema,
+		snapshotConn:   conn,
+	}
+
+	pos, err := s.snapshotPosition(ctx)
+	if err != nil {
+		s.release()
+		return nil, nil, err
+	}
+
+	return s, pos, nil
+}
+
+// snapshotPosition reads the position of the snapshot, it must be called on
+// the DB returned by snapshot.
+func (db *DB) snapshotPosition(ctx context.Context) (*SnapshotPosition, error) {
+	if db.dbType == DatabaseDriverPostgres {
+		// the snapshot is taken by the first query of the transaction, which
+		// is this one. The replicas have their own notion of the location.
+		var lsn sql.NullString
+		err := db.snapshotConn.GetContext(ctx, &lsn, `SELECT CASE WHEN pg_is_in_recovery()
+			THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END::text`)
+		if err != nil {
+			return nil, fmt.Errorf("could not get snapshot position: %w", err)
+		} else if !lsn.Valid {
+			return nil, nil
+		}
+		return &SnapshotPosition{LSN: lsn.String}, nil
+	}
+
+	// MariaDB and Percona Server record the position of the snapshot itself
+	pos, err := db.binlogSnapshotStatus(ctx)
+	if err != nil || pos != nil {
+		return pos, err
+	}
+
+	// otherwise the position is read in a statement of its own, after the
+	// snapshot is established.
+	values, err := db.snapshotConn.QueryRowxContext(ctx, "SHOW MASTER STATUS").SliceScan()
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrParse {
+		values, err = db.snapshotConn.QueryRowxContext(ctx, "SHOW BINARY LOG STATUS").SliceScan()
+	}
+
+	// there is no binary log or we can't see it
+	if errors.As(err, &mysqlErr) || errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not get snapshot position: %w", err)
+	}
+
+	// the columns are File, Position, Binlog_Do_DB, Binlog_Ignore_DB and
+	// Executed_Gtid_Set
+	pos = &SnapshotPosition{Approximate: true}
+	if len(values) > 1 {
+		pos.BinlogFile = fmt.Sprint(normalizeValue(values[0]))
+		pos.BinlogPosition, _ = strconv.ParseUint(fmt.Sprint(normalizeValue(values[1])), 10, 64)
+	}
+	if len(values) > 4 && values[4] != nil {
+		pos.GTIDSet = fmt.Sprint(normalizeValue(values[4]))
+	}
+
+	return pos, nil
+}
+
+// binlogSnapshotStatus reads the binary log position the snapshot of the
+// transaction was taken at from the session status. Only MariaDB and Percona
+// Server have it, a nil position is returned otherwise.
+func (db *DB) binlogSnapshotStatus(ctx context.Context) (*SnapshotPosition, error) {
+	var vars []struct {
+		Name  string `db:"Variable_name"`
+		Value string `db:"Value"`
+	}
+	err := db.snapshotConn.SelectContext(ctx, &vars, `SHOW SESSION STATUS LIKE 'Binlog\_snapshot\_%'`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get snapshot position: %w", err)
+	}
+
+	pos := &SnapshotPosition{}
+	for _, v := range vars {
+		switch strings.ToLower(v.Name) {
+		case "binlog_snapshot_file":
+			pos.BinlogFile = v.Value
+		case "binlog_snapshot_position":
+			pos.BinlogPosition, _ = strconv.ParseUint(v.Value, 10, 64)
+		case "binlog_snapshot_gtid_executed":
+			pos.GTIDSet = v.Value
+		}
+	}
+
+	// the binary log is disabled
+	if pos.BinlogFile == "" {
+		return nil, nil
+	}
+
+	return pos, nil
+}
+
+// release ends the transaction of the snapshot and returns its connection to
+// the pool. The transaction only read the data, so it's rolled back.
+func (db *DB) release() {
+	if db.snapshotConn == nil {
+		return
+	}
+
+	// the context of the comparison might be done already
+	_, err := db.snapshotConn.ExecContext(context.Background(), "ROLLBACK")
+	if err != nil {
+		// the connection is in an unknown state, it's not reused
+		_ = db.snapshotConn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	db.snapshotConn.Close()
+	db.snapshotConn = nil
+}
+
+// snapshots takes the snapshots of both sides at the same time, so that they
+// are as close as possible. Neither snapshot is kept if either one fails.
+func snapshots(ctx context.Context, srcdb, dstdb *DB) (*DB, *DB, *SnapshotPosition, *SnapshotPosition, error) {
+	var src, dst *DB
+	var srcPos, dstPos *SnapshotPosition
+	err := concurrently(func() error {
+		var err error
+		src, srcPos, err = srcdb.snapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("could not take src snapshot: %w", err)
+		}
+		return nil
+	}, func() error {
+		var err error
+		dst, dstPos, err = dstdb.snapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("could not take dst snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if src != nil {
+			src.release()
+		}
+		if dst != nil {
+			dst.release()
+		}
+		return nil, nil, nil, nil, err
+	}
+
+	return src, dst, srcPos, dstPos, nil
+}
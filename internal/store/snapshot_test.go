@@ -0,0 +1,23 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotPositionString(t *testing.T) {
+	var p *SnapshotPosition
+	require.Equal(t, "", p.String())
+
+	p = &SnapshotPosition{BinlogFile: "binlog.000003", BinlogPosition: 157}
+	require.Equal(t, "binlog.000003:157", p.String())
+
+	p.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	require.Equal(t, p.GTIDSet, p.String())
+
+	p.Approximate = true
+	require.Equal(t, p.GTIDSet+" (approximate)", p.String())
+
+	require.Equal(t, "0/16B3748", (&SnapshotPosition{LSN: "0/16B3748"}).String())
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// splitRanges splits the key space of the table into n ranges holding about
+// the same number of rows. The boundaries are the keys of the rows at evenly
+// spaced offsets, the first range is unbounded below and the last one above.
+func (db *DB) splitRanges(ctx context.Context, table *TableInfo, rowCount, n int) ([]KeyRange, error) {
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Question)
+	tableName := table.TableName
+	if db.dbType == DatabaseDriverPostgres {
+		builder = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+		currentSchema, err := db.currentSchema()
+		if err != nil {
+			return nil, err
+		}
+		tableName = strings.Join([]string{currentSchema, tableName}, ".")
+	}
+
+	var ranges []KeyRange
+	var from []any
+	for i := 1; i < n; i++ {
+		query, args, err := builder.
+			Select(table.PrimaryKeys...).
+			From(tableName).
+			OrderBy(orderBy(db.orderingKeys(table), "ASC")).
+			Limit(1).
+			Offset(uint64(i*rowCount/n - 1)).
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("could not build boundary query: %w", err)
+		}
+
+		// the table might have shrunk since it was counted
+		var to []any
+		err = db.retry(ctx, table.TableName, query, func() error {
+			to, err = db.conn().QueryRowxContext(ctx, db.tagged(query), args...).SliceScan()
+			return err
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("could not select boundary: %w", err)
+		}
+		for j := range to {
+			to[j] = normalizeValue(to[j])
+		}
+
+		ranges = append(ranges, KeyRange{From: from, To: to})
+		from = to
+	}
+
+	return append(ranges, KeyRange{From: from}), nil
+}
+
+// splitOutcome is the outcome of walking the pages of a single split of a
+// table. It's persisted along with the position of the walk so that an
+// interrupted comparison can be resumed.
+type splitOutcome struct {
+	Range KeyRange `json:"range"`
+	// Cursor is the exclusive lower bound of the next page, the split is
+	// walked from its beginning if it's nil.
+	Cursor           []any      `json:"cursor,omitempty"`
+	Done             bool       `json:"done"`
+	Pages            int        `json:"pages"`
+	FirstMismatch    *KeyRange  `json:"first_mismatch,omitempty"`
+	MismatchedRanges []KeyRange `json:"mismatched_ranges,omitempty"`
+	// Reverification is the outcome of re-checking the mismatching pages.
+	Reverification *Reverification `json:"reverification,omitempty"`
+}
+
+// walk compares the remaining pages of the split, it stops at the first
+// mismatching page unless the mismatching pages are bisected. The progress is
+// passed to save after each page.
+func (o *splitOutcome) walk(ctx context.Context, srcdb, dstdb *DB, src, dst *TableInfo, opts CompareOptions, save func(splitOutcome) error) error {
+	if o.Done {
+		return nil
+	}
+
+	bounds := o.Range
+	if o.Cursor != nil {
+		bounds.From = o.Cursor
+	}
+
+	err := walkPages(ctx, srcdb, dstdb, src, dst, bounds, opts.PageSize, func(page cursorData, equal bool) (bool, error) {
+		o.Pages++
+		next := true
+
+		// the page is different only if it stays different
+		if !equal && opts.Reverify > 0 {
+			retries, converged, err := reverify(ctx, opts, func() (bool, error) {
+				return checksumsEqual(ctx, srcdb, dstdb, src, dst, page)
+			})
+			if err != nil {
+				return false, err
+			}
+			o.Reverification = o.Reverification.add(retries, converged, &KeyRange{From: page.cursors, To: page.upper})
+			equal = converged
+		}
+
+		if !equal {
+			if o.FirstMismatch == nil {
+				o.FirstMismatch = &KeyRange{From: page.cursors, To: page.upper}
+			}
+
+			if opts.MinRangeSize == 0 {
+				next = false
+			} else {
+				r, err := bisectPage(ctx, srcdb, dstdb, src, dst, page, opts.MinRangeSize)
+				if err != nil {
+					return false, err
+				}
+				o.MismatchedRanges = append(o.MismatchedRanges, r...)
+			}
+		}
+
+		// only the last page of an unbounded split has no upper bound
+		o.Cursor = page.upper
+		o.Done = !next || page.upper == nil
+
+		return next, save(*o)
+	})
+	if err != nil {
+		return err
+	}
+
+	o.Done = true
+	return save(*o)
+}
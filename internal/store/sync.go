@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SyncOptions controls how the repair statements are applied on the target.
+type SyncOptions struct {
+	// BatchSize is the number of statements applied in a single transaction.
+	BatchSize int
+	// RateLimit is the maximum number of statements applied per second,
+	// zero means no limit.
+	RateLimit int
+	// Confirm is called before the statements of a table are applied, the
+	// table is skipped if it returns false. A nil Confirm applies all.
+	Confirm func(r *TableRepair) bool
+}
+
+// TableSync is the outcome of the synchronization of a single table.
+type TableSync struct {
+	TableName string
+	Inserts   int
+	Updates   int
+	Deletes   int
+	// Skipped is true if the statements are not confirmed.
+	Skipped bool
+	// Mismatches are the repaired pages whose checksums still differ.
+	Mismatches []KeyRange
+}
+
+// Sync finds the differing rows like Repair does and applies the generated
+// statements on the target in batched transactions. Each repaired page is
+// checksummed again afterwards to verify the repair. The warnings of Diff are
+// returned as well.
+func Sync(ctx context.Context, srcDSN, dstDSN string, opts CompareOptions, syncOpts SyncOptions) ([]*TableSync, []string, error) {
+	if syncOpts.BatchSize < 1 {
+		return nil, nil, fmt.Errorf("batch size could not be less than 1 (one), current value is: %d", syncOpts.BatchSize)
+	}
+
+	srcdb, dstdb, err := openDatabases(srcDSN, dstDSN, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer srcdb.sqlDB.Close()
+	defer dstdb.sqlDB.Close()
+
+	stop := killQueriesOnDone(ctx, srcdb, dstdb)
+	defer stop()
+
+	var syncs []*TableSync
+	warnings, err := repairTables(ctx, srcdb, dstdb, opts, func(src, dst *TableInfo, r *TableRepair) error {
+		s := &TableSync{
+			TableName: r.TableName,
+		}
+		syncs = append(syncs, s)
+
+		if syncOpts.Confirm != nil && !syncOpts.Confirm(r) {
+			s.Skipped = true
+			return nil
+		}
+
+		err := dstdb.applyStatements(ctx, r.Statements, syncOpts.BatchSize, syncOpts.RateLimit)
+		if err != nil {
+			return fmt.Errorf("could not apply statements on %q: %w", r.TableName, err)
+		}
+		s.Inserts, s.Updates, s.Deletes = r.Inserts, r.Updates, r.Deletes
+
+		for _, page := range r.Pages {
+			equal, err := checksumsEqual(ctx, srcdb, dstdb, src, dst, cursorData{cursors: page.From, upper: page.To})
+			if err != nil {
+				return fmt.Errorf("could not verify %q: %w", r.TableName, err)
+			}
+
+			if !equal {
+				s.Mismatches = append(s.Mismatches, page)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return syncs, warnings, err
+	}
+
+	return syncs, warnings, nil
+}
+
+// applyStatements executes the statements in transactions of batchSize
+// statements. If rateLimit is set, it waits between the batches to execute
+// no more than rateLimit statements per second.
+func (db *DB) applyStatements(ctx context.Context, statements []string, batchSize, rateLimit int) error {
+	for start := 0; start < len(statements); start += batchSize {
+		end := start + batchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		began := time.Now()
+		tx, err := db.sqlDB.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("could not begin transaction: %w", err)
+		}
+
+		for _, stmt := range statements[start:end] {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("could not execute %q: %w", stmt, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit transaction: %w", err)
+		}
+
+		if rateLimit > 0 {
+			wait := time.Duration(end-start)*time.Second/time.Duration(rateLimit) - time.Since(began)
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+
+	return nil
+}
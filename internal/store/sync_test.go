@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ec := rand.Intn(100) + 20
+	h := newTestHelper(t).SeedTableData(ec)
+	defer h.Teardown()
+
+	pgdb, ok := h.dbInstances["postgres"]
+	require.True(t, ok)
+
+	_, err := pgdb.sqlDB.Exec("DELETE FROM Table1 WHERE Id IN (SELECT Id FROM Table1 LIMIT 3)")
+	require.NoError(t, err)
+	_, err = pgdb.sqlDB.Exec("DELETE FROM Table2 WHERE Id IN (SELECT Id FROM Table2 LIMIT 1)")
+	require.NoError(t, err)
+
+	t.Run("declined tables are skipped", func(t *testing.T) {
+		syncs, _, err := Sync(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{PageSize: 20}, SyncOptions{
+			BatchSize: 2,
+			Confirm:   func(r *TableRepair) bool { return false },
+		})
+		require.NoError(t, err)
+		require.Len(t, syncs, 2)
+		for _, s := range syncs {
+			require.True(t, s.Skipped)
+		}
+	})
+
+	t.Run("confirmed tables are applied", func(t *testing.T) {
+		syncs, _, err := Sync(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{PageSize: 20}, SyncOptions{
+			BatchSize: 2,
+		})
+		require.NoError(t, err)
+		require.Len(t, syncs, 2)
+		require.Equal(t, 3, syncs[0].Inserts)
+		require.Equal(t, 1, syncs[1].Inserts)
+		for _, s := range syncs {
+			require.Empty(t, s.Mismatches)
+		}
+
+		result, err := Compare(context.Background(), mysqlTestDSN, pgsqlTestDSN, CompareOptions{PageSize: 20})
+		require.NoError(t, err)
+		require.True(t, result.Equal())
+	})
+}
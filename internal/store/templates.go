@@ -11,35 +11,134 @@ import (
 // Concatenate those results, and MD5 this result.
 // Split into 4 8-character hex strings.
 // Convert into 32-bit integers and sum.
+//
+// Along with the sums, the checksum templates return the number of rows in the
+// page and the last key of the page so that the cursor can be advanced without
+// additional queries. MySQL 5.7 has no common table expressions, hence the page
+// is selected twice there.
 
-const MySQLChecksumTmpl = `select 
-  sum(cast(conv(substring(hash, 1, 8), 16, 10) as unsigned)) as a, 
-  sum(cast(conv(substring(hash, 9, 8), 16, 10) as unsigned)) as b, 
-  sum(cast(conv(substring(hash, 17, 8), 16, 10) as unsigned)) as c, 
-  sum(cast(conv(substring(hash, 25, 8), 16, 10) as unsigned)) as d
+const MySQLChecksumTmpl = `select
+  s.a, s.b, s.c, s.d, s.n{{ if .KeyQuery }}, {{ .LastKeyQuery }}{{ end }}
+from (
+  select
+    sum(cast(conv(substring(hash, 1, 8), 16, 10) as unsigned)) as a,
+    sum(cast(conv(substring(hash, 9, 8), 16, 10) as unsigned)) as b,
+    sum(cast(conv(substring(hash, 17, 8), 16, 10) as unsigned)) as c,
+    sum(cast(conv(substring(hash, 25, 8), 16, 10) as unsigned)) as d,
+    count(*) as n
+  from (
+    select md5(
+      concat(
+{{ .ColumnQuery}}
+      )
+    ) as "hash"
+    from {{ .TableName }} {{ .CursorQuery }}
+  ) as t
+) as s{{ if .KeyQuery }}
+left join (
+  select {{ .KeyQuery }}
+  from (
+    select {{ .KeyQuery }}
+    from {{ .TableName }} {{ .CursorQuery }}
+  ) as p
+  order by {{ .LastKeyOrder }}
+  limit 1
+) as l on true{{ end }};
+`
+
+// The ‘x’ prepended to the hash strings, which tells Postgres to interpret
+// them as hex strings when casting to a number.
+const PostgresChecksumTmpl = `with page as (
+  select {{ if .KeyQuery }}{{ .KeyQuery }}, {{ end }}md5 (
+{{ .ColumnQuery}}
+  ) as "hash"
+  from  {{.CurrentSchema}}.{{ .TableName }} {{ .CursorQuery }}
+)
+select
+  s.a, s.b, s.c, s.d, s.n{{ if .KeyQuery }}, {{ .LastKeyQuery }}{{ end }}
 from (
-  select md5(
+  select
+    sum(('x' || substring(hash, 1, 8))::bit(32)::bigint) as a,
+    sum(('x' || substring(hash, 9, 8))::bit(32)::bigint) as b,
+    sum(('x' || substring(hash, 17, 8))::bit(32)::bigint) as c,
+    sum(('x' || substring(hash, 25, 8))::bit(32)::bigint) as d,
+    count(*) as n
+  from page
+) as s{{ if .KeyQuery }}
+left join (
+  select {{ .KeyQuery }}
+  from page
+  order by {{ .LastKeyOrder }}
+  limit 1
+) as l on true{{ end }};
+`
+
+// The row hash templates compute the same per-row md5 as the checksum
+// templates above, but return it along with the primary key values of each
+// row instead of summing them up. They are used to find out which rows differ
+// once a page checksum does not match.
+
+const MySQLRowHashTmpl = `select {{ .KeyQuery }},
+  md5(
     concat(
 {{ .ColumnQuery}}
     )
   ) as "hash"
-  from {{ .TableName }} {{ .CursorQuery }}
-) as t;
+from {{ .TableName }} {{ .CursorQuery }};
 `
 
-// The ‘x’ prepended to the hash strings, which tells Postgres to interpret
-// them as hex strings when casting to a number.
-const PostgresChecksumTmpl = `select
+const PostgresRowHashTmpl = `select {{ .KeyQuery }},
+  md5 (
+{{ .ColumnQuery}}
+  ) as "hash"
+from  {{.CurrentSchema}}.{{ .TableName }} {{ .CursorQuery }};
+`
+
+// The bucket templates compute the checksums of the rows grouped into buckets
+// instead of pages. A row is assigned to a bucket by the first 32 bits of the
+// md5 of its key columns, hashed the same way as the rest of the columns, so
+// that both databases put the same row into the same bucket.
+
+const MySQLBucketChecksumTmpl = `select
+  bucket,
+  sum(cast(conv(substring(hash, 1, 8), 16, 10) as unsigned)) as a,
+  sum(cast(conv(substring(hash, 9, 8), 16, 10) as unsigned)) as b,
+  sum(cast(conv(substring(hash, 17, 8), 16, 10) as unsigned)) as c,
+  sum(cast(conv(substring(hash, 25, 8), 16, 10) as unsigned)) as d
+from (
+  select
+    cast(conv(substring(md5(
+      concat(
+{{ .KeyQuery }}
+      )
+    ), 1, 8), 16, 10) as unsigned) % {{ .Buckets }} as bucket,
+    md5(
+      concat(
+{{ .ColumnQuery}}
+      )
+    ) as "hash"
+  from {{ .TableName }}
+) as t
+group by bucket;
+`
+
+const PostgresBucketChecksumTmpl = `select
+  bucket,
   sum(('x' || substring(hash, 1, 8))::bit(32)::bigint) as a,
   sum(('x' || substring(hash, 9, 8))::bit(32)::bigint) as b,
   sum(('x' || substring(hash, 17, 8))::bit(32)::bigint) as c,
   sum(('x' || substring(hash, 25, 8))::bit(32)::bigint) as d
 from (
-  select md5 (
+  select
+    ('x' || substring(md5 (
+{{ .KeyQuery }}
+    ), 1, 8))::bit(32)::bigint % {{ .Buckets }} as bucket,
+    md5 (
 {{ .ColumnQuery}}
-  ) as "hash"
-  from  {{.CurrentSchema}}.{{ .TableName }} {{ .CursorQuery }}
-) as t;
+    ) as "hash"
+  from  {{.CurrentSchema}}.{{ .TableName }}
+) as t
+group by bucket;
 `
 
 // generateQueryForColumns creates the query for specific driver to calculate
@@ -79,21 +178,27 @@ func generateQueryForColumns(driver string, columns []*ColumnInfo) string {
 }
 
 // generateQueryForPagination as name suggests generates the partial query parameters
-// to allow pagination.
-func generateQueryForPagination(driver string, primaryKeys []string, lastCursors []any) (string, []any, error) {
-	if lastCursors == nil {
-		return fmt.Sprintf("ORDER BY %s ASC", strings.Join(primaryKeys, ",")), nil, nil
+// to allow pagination. The lastCursors are the exclusive lower bound of the page
+// whereas the upperCursors are the inclusive upper bound, either can be nil.
+func generateQueryForPagination(driver string, primaryKeys []string, lastCursors, upperCursors []any) (string, []any, error) {
+	if lastCursors == nil && upperCursors == nil {
+		// the tables without keys are read as a whole
+		if len(primaryKeys) == 0 {
+			return "", nil, nil
+		}
+		return "ORDER BY " + orderBy(primaryKeys, "ASC"), nil, nil
 	}
 
-	if len(primaryKeys) != len(lastCursors) {
+	if lastCursors != nil && len(primaryKeys) != len(lastCursors) {
 		return "", nil, fmt.Errorf("primary keys (%d) and cursor count (%d) does not match", len(primaryKeys), len(lastCursors))
 	}
 
-	var c sq.Or
-	for i := range primaryKeys {
-		c = append(c, sq.Gt{primaryKeys[i]: lastCursors[i]})
+	if upperCursors != nil && len(primaryKeys) != len(upperCursors) {
+		return "", nil, fmt.Errorf("primary keys (%d) and upper cursor count (%d) does not match", len(primaryKeys), len(upperCursors))
 	}
 
+	c := pageCondition(driver, primaryKeys, lastCursors, upperCursors)
+
 	builder := sq.StatementBuilder.PlaceholderFormat(sq.Question)
 	if driver == DatabaseDriverPostgres {
 		builder = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
@@ -102,7 +207,7 @@ func generateQueryForPagination(driver string, primaryKeys []string, lastCursors
 	// we use a select builder to be able to generate query for the primary keys
 	// we will remove the "SELECT" part later on. Ideally we should've be able to
 	// build query from a where statment.
-	sb := builder.Select("").Where(c).OrderBy(primaryKeys...)
+	sb := builder.Select("").Where(c).OrderBy(orderBy(primaryKeys, "ASC"))
 	q1, a1, err := sb.ToSql()
 	if err != nil {
 		return "", nil, fmt.Errorf("could not build query for the cursor: %w", err)
@@ -110,3 +215,84 @@ func generateQueryForPagination(driver string, primaryKeys []string, lastCursors
 
 	return strings.TrimPrefix(q1, "SELECT"), a1, nil
 }
+
+// pageCondition builds the WHERE condition of a page, either of the bounds
+// can be nil.
+func pageCondition(driver string, primaryKeys []string, lastCursors, upperCursors []any) sq.And {
+	var c sq.And
+	if lastCursors != nil {
+		c = append(c, keysetCondition(driver, primaryKeys, lastCursors, true))
+	}
+
+	if upperCursors != nil {
+		c = append(c, keysetCondition(driver, primaryKeys, upperCursors, false))
+	}
+
+	return c
+}
+
+// keysetCondition builds the condition comparing the primary keys with the
+// given values in lexicographic order. A lower bound is exclusive, i.e.
+// (k1, k2) > (v1, v2), whereas an upper bound is inclusive, i.e.
+// (k1, k2) <= (v1, v2). Postgres compares the row values natively, for MySQL
+// the condition is expanded as its row constructor comparisons are not able
+// to use the indexes on older versions:
+//
+//	(k1 > v1) OR (k1 = v1 AND k2 > v2)
+func keysetCondition(driver string, primaryKeys []string, values []any, lower bool) sq.Sqlizer {
+	if len(primaryKeys) == 1 {
+		if lower {
+			return sq.Gt{primaryKeys[0]: values[0]}
+		}
+		return sq.LtOrEq{primaryKeys[0]: values[0]}
+	}
+
+	if driver == DatabaseDriverPostgres {
+		op := "<="
+		if lower {
+			op = ">"
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+		return sq.Expr(fmt.Sprintf("(%s) %s (%s)", strings.Join(primaryKeys, ","), op, placeholders), values...)
+	}
+
+	var c sq.Or
+	for i := range primaryKeys {
+		var and sq.And
+		for j := 0; j < i; j++ {
+			and = append(and, sq.Eq{primaryKeys[j]: values[j]})
+		}
+		switch {
+		case lower:
+			and = append(and, sq.Gt{primaryKeys[i]: values[i]})
+		case i == len(primaryKeys)-1:
+			and = append(and, sq.LtOrEq{primaryKeys[i]: values[i]})
+		default:
+			and = append(and, sq.Lt{primaryKeys[i]: values[i]})
+		}
+		c = append(c, and)
+	}
+
+	return c
+}
+
+// binaryOrdered returns the expression comparing the string column byte-wise.
+// Both UTF-8 encoded, the bytes of MySQL and Postgres sort the same way.
+func binaryOrdered(driver, column string) string {
+	if driver == DatabaseDriverPostgres {
+		return column + ` COLLATE "C"`
+	}
+
+	return "CAST(" + column + " AS BINARY)"
+}
+
+// orderBy returns the ORDER BY clause for the primary keys, the direction
+// is applied to each of the keys.
+func orderBy(primaryKeys []string, direction string) string {
+	o := make([]string, len(primaryKeys))
+	for i := range primaryKeys {
+		o[i] = primaryKeys[i] + " " + direction
+	}
+
+	return strings.Join(o, ", ")
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateQueryForPagination(t *testing.T) {
+	pks := []string{"Id", "AnotherId"}
+
+	q, args, err := generateQueryForPagination(DatabaseDriverMysql, pks, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "ORDER BY Id ASC, AnotherId ASC", q)
+	require.Empty(t, args)
+
+	q, args, err = generateQueryForPagination(DatabaseDriverMysql, pks, []any{"a", "b"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE (((Id > ?) OR (Id = ? AND AnotherId > ?))) ORDER BY Id ASC, AnotherId ASC", q)
+	require.Equal(t, []any{"a", "a", "b"}, args)
+
+	q, args, err = generateQueryForPagination(DatabaseDriverMysql, pks, nil, []any{"c", "d"})
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE (((Id < ?) OR (Id = ? AND AnotherId <= ?))) ORDER BY Id ASC, AnotherId ASC", q)
+	require.Equal(t, []any{"c", "c", "d"}, args)
+
+	q, args, err = generateQueryForPagination(DatabaseDriverPostgres, pks, []any{"a", "b"}, []any{"c", "d"})
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE ((Id,AnotherId) > ($1,$2) AND (Id,AnotherId) <= ($3,$4)) ORDER BY Id ASC, AnotherId ASC", q)
+	require.Equal(t, []any{"a", "b", "c", "d"}, args)
+
+	q, args, err = generateQueryForPagination(DatabaseDriverPostgres, []string{"Id"}, []any{"a"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE (Id > $1) ORDER BY Id ASC", q)
+	require.Equal(t, []any{"a"}, args)
+
+	_, _, err = generateQueryForPagination(DatabaseDriverPostgres, pks, []any{"a"}, nil)
+	require.Error(t, err)
+}
+
+func TestOrderingKeys(t *testing.T) {
+	table := &TableInfo{
+		TableName:   "Table1",
+		PrimaryKeys: []string{"Id", "CreateAt"},
+		Columns: []*ColumnInfo{
+			{ColumnName: "id", DataType: "character varying"},
+			{ColumnName: "createat", DataType: "bigint"},
+		},
+	}
+
+	db := &DB{dbType: DatabaseDriverPostgres, binaryKeyOrder: true}
+	require.Equal(t, []string{`Id COLLATE "C"`, "CreateAt"}, db.orderingKeys(table))
+
+	db = &DB{dbType: DatabaseDriverMysql, binaryKeyOrder: true}
+	require.Equal(t, []string{"CAST(Id AS BINARY)", "CreateAt"}, db.orderingKeys(table))
+
+	q, args, err := generateQueryForPagination(DatabaseDriverMysql, db.orderingKeys(table), []any{"a", 1}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE (((CAST(Id AS BINARY) > ?) OR (CAST(Id AS BINARY) = ? AND CreateAt > ?))) ORDER BY CAST(Id AS BINARY) ASC, CreateAt ASC", q)
+	require.Equal(t, []any{"a", "a", 1}, args)
+
+	// the databases of the same dialect page through the primary key index
+	require.False(t, binaryKeyOrder(DatabaseDriverMysql, DatabaseDriverMysql, CompareOptions{}))
+	require.True(t, binaryKeyOrder(DatabaseDriverMysql, DatabaseDriverMysql, CompareOptions{BinaryKeyOrder: true}))
+	require.True(t, binaryKeyOrder(DatabaseDriverMysql, DatabaseDriverPostgres, CompareOptions{}))
+
+	db = &DB{dbType: DatabaseDriverMysql}
+	require.Equal(t, []string{"Id", "CreateAt"}, db.orderingKeys(table))
+
+	q, _, err = generateQueryForPagination(DatabaseDriverMysql, db.orderingKeys(table), []any{"a", 1}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "  WHERE (((Id > ?) OR (Id = ? AND CreateAt > ?))) ORDER BY Id ASC, CreateAt ASC", q)
+}
@@ -97,6 +97,34 @@ func (h *testHelper) SeedTableData(entryCount int) *testHelper {
 	return h
 }
 
+// SeedCompositeKeyData generates Table2 rows sharing the leading primary key
+// column, each of the leadingCount ids has rowsPerLeading rows.
+func (h *testHelper) SeedCompositeKeyData(leadingCount, rowsPerLeading int) *testHelper {
+	for i := 0; i < leadingCount; i++ {
+		id := newId()
+		for j := 0; j < rowsPerLeading; j++ {
+			s2 := testStruct2{
+				Id:        id,
+				AnotherId: newId(),
+				IsActive:  gofakeit.Bool(),
+				Props:     gofakeit.Map(),
+			}
+
+			for name, instance := range h.dbInstances {
+				query := `INSERT INTO Table2
+				(Id, AnotherId, IsActive, Props)
+				VALUES
+				(:Id, :AnotherId, :IsActive, :Props)
+				`
+				_, err := instance.sqlDB.NamedExec(query, s2)
+				require.NoError(h.t, err, "could not insert s2 on %q", name)
+			}
+		}
+	}
+
+	return h
+}
+
 // TearDown closes all database connections and removes all tables from the databases
 func (h *testHelper) Teardown() {
 	assets := testlib.Assets()
@@ -1,7 +1,13 @@
 package store
 
 import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
@@ -24,11 +30,111 @@ func normalizeDSN(dataSource string) (string, error) {
 	return config.FormatDSN(), nil
 }
 
-func sliceToMap(inc []string) map[string]struct{} {
-	m := make(map[string]struct{})
-	for i := 0; i < len(inc); i++ {
-		m[inc[i]] = struct{}{}
+// withStatementTimeout sets the timeout of the statements as a session
+// setting of the data source, a zero timeout leaves the data source as it is.
+// Both databases take the timeout in milliseconds.
+func withStatementTimeout(dataSource string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return dataSource, nil
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	if strings.HasPrefix(dataSource, "postgres") {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	config, err := mysql.ParseDSN(dataSource)
+	if err != nil {
+		return "", err
+	}
+
+	if config.Params == nil {
+		config.Params = map[string]string{}
+	}
+
+	// the unknown parameters are set as session variables by the driver
+	config.Params["max_execution_time"] = ms
+	return config.FormatDSN(), nil
+}
+
+// dsnHost returns the host and the database name of a data source, leaving
+// the credentials and the parameters out.
+func dsnHost(dataSource string) (string, string) {
+	if strings.HasPrefix(dataSource, "postgres") {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return "", ""
+		}
+		return u.Host, strings.TrimPrefix(u.Path, "/")
+	}
+
+	config, err := mysql.ParseDSN(dataSource)
+	if err != nil {
+		return "", ""
+	}
+
+	return config.Addr, config.DBName
+}
+
+// normalizeValue converts the driver specific representation of a value
+// into a comparable one. The mysql driver returns most of the values as
+// byte slices whereas postgres returns strings.
+func normalizeValue(v any) any {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+
+	return v
+}
+
+// keyString returns a string representation of the primary key values
+// that can be used as a map key.
+func keyString(keys []any) string {
+	s := make([]string, len(keys))
+	for i := range keys {
+		s[i] = fmt.Sprint(keys[i])
+	}
+
+	return strings.Join(s, "\x00")
+}
+
+// sortedTableNames returns the keys of the table map in order.
+func sortedTableNames(tables map[string]*TableInfo) []string {
+	names := make([]string, 0, len(tables))
+	for k := range tables {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// concurrently runs the functions concurrently and waits for all of them to
+// return. The first error in the order of the functions is returned.
+func concurrently(fns ...func() error) error {
+	errs := make([]error, len(fns))
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn func() error) {
+			defer wg.Done()
+			errs[i] = fn()
+		}(i, fn)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 
-	return m
+	return nil
 }